@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bytes"
 	goerrors "errors"
 	"fmt"
+	"go/build"
 	"net/url"
 	"path/filepath"
 
+	"github.com/pipe01/poodle/internal/generator"
 	"github.com/pipe01/poodle/internal/lexer"
+	"github.com/pipe01/poodle/internal/parser/ast"
+	"github.com/pipe01/poodle/internal/typecheck"
 	"github.com/pipe01/poodle/internal/workspace"
 	"github.com/tliron/commonlog"
 	"github.com/tliron/glsp"
@@ -23,9 +28,14 @@ var handler protocol.Handler
 
 var documents = map[string]string{}
 
+// Whether to type-check the generated code, enabled with the "typeCheck"
+// initialization option
+var typeCheck bool
+
 type SituatedErr interface {
 	Unwrap() error
 	At() lexer.Location
+	Range() lexer.Range
 }
 
 func main() {
@@ -94,24 +104,18 @@ func handleDocument(context *glsp.Context, docURI string) error {
 
 	diag := []protocol.Diagnostic{}
 
-	_, err = ws.LoadWithContents(fileName, []byte(contents))
+	f, err := ws.LoadWithContents(fileName, []byte(contents))
+	if err == nil && typeCheck {
+		err = checkFile(ws, f, filePath)
+	}
 	if err != nil {
-		var poserr SituatedErr
-
-		if goerrors.As(err, &poserr) {
-			diag = append(diag, protocol.Diagnostic{
-				Range: protocol.Range{
-					Start: pos(poserr.At()),
-					End:   pos(poserr.At()),
-				},
-				Severity: ptr(protocol.DiagnosticSeverityError),
-				Message:  poserr.Unwrap().Error(),
-			})
-		} else {
-			diag = append(diag, protocol.Diagnostic{
-				Severity: ptr(protocol.DiagnosticSeverityError),
-				Message:  err.Error(),
-			})
+		var errs workspace.ErrorList
+		if !goerrors.As(err, &errs) {
+			errs = workspace.ErrorList{err}
+		}
+
+		for _, err := range errs {
+			diag = append(diag, errorDiagnostic(err))
 		}
 	}
 
@@ -123,7 +127,65 @@ func handleDocument(context *glsp.Context, docURI string) error {
 	return nil
 }
 
+// checkFile type-checks the code generated for f, assuming that it's written
+// next to the template at filePath with the default generator options.
+func checkFile(ws *workspace.Workspace, f *ast.File, filePath string) error {
+	dir := filepath.Dir(filePath)
+
+	pkgName := "main"
+	if pkg, err := build.ImportDir(dir, 0); err == nil {
+		pkgName = pkg.Name
+	}
+
+	var buf bytes.Buffer
+
+	err := generator.Visit(&buf, f, generator.Options{
+		Package:        pkgName,
+		ForceExport:    true,
+		UseBufioWriter: true,
+		LineDirectives: true,
+		SourceDir:      ".",
+	})
+	if err != nil {
+		return err
+	}
+
+	return typecheck.Check(filePath+".go", buf.Bytes(), f, ws.RootPath())
+}
+
+func errorDiagnostic(err error) protocol.Diagnostic {
+	var poserr SituatedErr
+
+	if goerrors.As(err, &poserr) {
+		rng := poserr.Range()
+
+		// Make sure the diagnostic spans at least one character
+		if rng.End.Line < rng.Start.Line || (rng.End.Line == rng.Start.Line && rng.End.Column <= rng.Start.Column) {
+			rng.End = rng.Start
+			rng.End.Column++
+		}
+
+		return protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: pos(rng.Start),
+				End:   pos(rng.End),
+			},
+			Severity: ptr(protocol.DiagnosticSeverityError),
+			Message:  poserr.Unwrap().Error(),
+		}
+	}
+
+	return protocol.Diagnostic{
+		Severity: ptr(protocol.DiagnosticSeverityError),
+		Message:  err.Error(),
+	}
+}
+
 func initialize(context *glsp.Context, params *protocol.InitializeParams) (any, error) {
+	if opts, ok := params.InitializationOptions.(map[string]any); ok {
+		typeCheck, _ = opts["typeCheck"].(bool)
+	}
+
 	capabilities := handler.CreateServerCapabilities()
 	// capabilities.SemanticTokensProvider = &protocol.SemanticTokensOptions{
 	// 	Legend: protocol.SemanticTokensLegend{
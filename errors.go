@@ -5,4 +5,5 @@ import "github.com/pipe01/poodle/internal/lexer"
 type SituatedErr interface {
 	Unwrap() error
 	At() lexer.Location
+	Range() lexer.Range
 }
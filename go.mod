@@ -1,18 +1,21 @@
 module github.com/pipe01/poodle
 
-go 1.19
+// Go 1.22 is required by golang.org/x/tools, which the check command uses to
+// type-check generated code
+go 1.22.0
 
 require (
 	github.com/alecthomas/kingpin/v2 v2.3.2
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/tliron/commonlog v0.1.0
 	github.com/tliron/glsp v0.2.0
 	golang.org/x/exp v0.0.0-20230905200255-921286631fa9
+	golang.org/x/tools v0.26.0
 )
 
 require (
 	github.com/alecthomas/units v0.0.0-20211218093645-b94a6e3cc137 // indirect
 	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
-	github.com/fsnotify/fsnotify v1.6.0 // indirect
 	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/iancoleman/strcase v0.2.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
@@ -30,6 +33,8 @@ require (
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/xhit/go-str2duration/v2 v2.1.0 // indirect
 	golang.org/x/crypto v0.8.0 // indirect
-	golang.org/x/sys v0.12.0 // indirect
+	golang.org/x/mod v0.21.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
 	golang.org/x/term v0.7.0 // indirect
 )
@@ -0,0 +1,309 @@
+package generator
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pipe01/poodle/internal/parser/ast"
+	"github.com/pipe01/poodle/runtime"
+)
+
+// Name of the variable that holds the value of an attribute while checking
+// whether it should be written
+const attrValueVar = "_value"
+
+// Name of the variable that holds the attributes added with "&attributes"
+const spreadAttrsVar = "_attrs"
+
+// Runtime functions that build the value of attributes that can be given
+// several times or as a Go collection, by attribute name
+var listAttributes = map[string]string{
+	"class": "poodle.Classes",
+	"style": "poodle.Styles",
+}
+
+// visitAttributes writes attrs, merging the list attributes that have Go
+// values or are given more than once. If spread isn't empty, it's a Go
+// expression whose attributes are written after attrs, replacing the ones
+// with the same name.
+func (c *context) visitAttributes(attrs []ast.TagAttribute, spread string) {
+	if spread != "" {
+		c.w.WriteBlockStart()
+		c.w.WriteVariable(spreadAttrsVar, "poodle.Attributes", "poodle.ToAttributes("+spread+")")
+	}
+
+	merged := map[string]bool{}
+
+	for _, attr := range attrs {
+		if _, ok := listAttributes[attr.Name]; ok && (spread != "" || needsMerging(attr.Name, attrs)) {
+			if !merged[attr.Name] {
+				merged[attr.Name] = true
+				c.visitListAttribute(attr, attrs, spread != "")
+			}
+			continue
+		}
+
+		c.w.SetPosition(attr.Position())
+
+		cond := attr.Condition
+		if spread != "" {
+			cond = "!" + spreadAttrsVar + ".Has(" + strconv.Quote(attr.Name) + ")"
+			if attr.Condition != "" {
+				cond += " && (" + attr.Condition + ")"
+			}
+		}
+
+		if cond != "" {
+			c.w.WriteStatementStart(true, "if", cond)
+		}
+
+		c.visitAttribute(attr)
+
+		if cond != "" {
+			c.w.WriteBlockEnd(true)
+		}
+	}
+
+	if spread == "" {
+		return
+	}
+
+	// The spread attributes' classes and styles are merged with the element's
+	for _, name := range []string{"class", "style"} {
+		if !merged[name] {
+			c.visitListAttribute(ast.TagAttribute{Name: name}, nil, true)
+		}
+	}
+
+	c.w.WriteAttributes(spreadAttrsVar, "class", "style")
+	c.w.WriteBlockEnd(true)
+}
+
+// needsMerging returns whether the attributes called name in attrs have to be
+// merged at runtime.
+func needsMerging(name string, attrs []ast.TagAttribute) bool {
+	count := 0
+
+	for _, attr := range attrs {
+		if attr.Name != name {
+			continue
+		}
+		count++
+
+		if !isStatic(attr.Value) {
+			return true
+		}
+	}
+
+	return count > 1
+}
+
+// isStatic returns whether v doesn't contain any Go expressions.
+func isStatic(v ast.Value) bool {
+	switch v := v.(type) {
+	case ast.ValueGoExpr:
+		return false
+	case ast.ValueConcat:
+		return isStatic(v.A) && isStatic(v.B)
+	}
+
+	return true
+}
+
+// visitListAttribute writes a single attribute with the values of all the
+// attributes in attrs with the same name as first, built at runtime. If spread
+// is true, the value of the attribute added with "&attributes" is included too.
+func (c *context) visitListAttribute(first ast.TagAttribute, attrs []ast.TagAttribute, spread bool) {
+	var parts []string
+
+	for _, attr := range attrs {
+		if attr.Name != first.Name || attr.Value == nil {
+			continue
+		}
+
+		part := goValue(attr.Value)
+		if first.Name == "style" {
+			part = styleValue(attr.Value)
+		}
+		if attr.Condition != "" {
+			part = "poodle.When(" + attr.Condition + ", " + part + ")"
+		}
+
+		parts = append(parts, part)
+	}
+	if spread {
+		parts = append(parts, spreadAttrsVar+".Get("+strconv.Quote(first.Name)+")")
+	}
+
+	c.w.SetPosition(first.Position())
+
+	// The runtime escapes each value on its own, so the result only needs to
+	// be escaped for HTML
+	c.visitExprAttribute(first.Name, ast.ValueGoExpr{
+		Pos:      first.Pos,
+		Contents: listAttributes[first.Name] + "(" + strings.Join(parts, ", ") + ")",
+		Escape:   true,
+	}, "string", contextAttr)
+}
+
+// styleValue returns a Go expression whose result is the style attribute
+// value v. Declarations in the template are trusted, but the Go values
+// interpolated into them are escaped on their own, since after joining them
+// Styles couldn't tell their semicolons apart from the template's.
+func styleValue(v ast.Value) string {
+	switch v := v.(type) {
+	case ast.ValueGoExpr:
+		return v.Contents
+
+	case ast.ValueConcat:
+		var parts []string
+		for _, v := range concatParts(v) {
+			part := goValue(v)
+			if _, ok := v.(ast.ValueGoExpr); ok {
+				part = "poodle.EscapeCSSValue(" + part + ")"
+			}
+			parts = append(parts, part)
+		}
+
+		return "poodle.CSS(poodle.Concat(" + strings.Join(parts, ", ") + "))"
+	}
+
+	return "poodle.CSS(" + goValue(v) + ")"
+}
+
+// goValue returns a Go expression whose result is v.
+func goValue(v ast.Value) string {
+	switch v := v.(type) {
+	case ast.ValueLiteral:
+		return strconv.Quote(v.Contents)
+
+	case ast.ValueGoExpr:
+		return v.Contents
+
+	case ast.ValueConcat:
+		var parts []string
+		for _, v := range concatParts(v) {
+			parts = append(parts, goValue(v))
+		}
+
+		return "poodle.Concat(" + strings.Join(parts, ", ") + ")"
+	}
+
+	return `""`
+}
+
+// concatParts returns the values that are joined together by v, in order.
+func concatParts(v ast.ValueConcat) []ast.Value {
+	var parts []ast.Value
+
+	var add func(v ast.Value)
+	add = func(v ast.Value) {
+		if concat, ok := v.(ast.ValueConcat); ok {
+			add(concat.A)
+			add(concat.B)
+		} else {
+			parts = append(parts, v)
+		}
+	}
+	add(v)
+
+	return parts
+}
+
+// visitAttribute writes attr. If its value is a single Go expression, the
+// attribute is left out or written without a value depending on the result.
+func (c *context) visitAttribute(attr ast.TagAttribute) {
+	ectx := attributeContext(attr.Name)
+
+	expr, isExpr := attr.Value.(ast.ValueGoExpr)
+	if !isExpr {
+		if attr.Value == nil {
+			c.w.WriteLiteralUnescapedf(" %s", attr.Name)
+			return
+		}
+
+		c.w.WriteLiteralUnescapedf(` %s="`, attr.Name)
+		c.visitValue(attr.Value, ectx)
+		c.w.WriteLiteralUnescaped(`"`)
+		return
+	}
+
+	c.w.SetPosition(expr.Position())
+	c.visitExprAttribute(attr.Name, expr, c.exprType(expr.Contents), ectx)
+}
+
+// visitExprAttribute writes an attribute whose value is the Go expression
+// expr of type typ, which is empty if it's not known.
+func (c *context) visitExprAttribute(name string, expr ast.ValueGoExpr, typ string, ectx escapeContext) {
+	switch {
+	case isIntType(typ), isUintType(typ):
+		// Numbers are never left out
+		c.w.WriteLiteralUnescapedf(` %s="`, name)
+		c.visitValue(expr, ectx)
+		c.w.WriteLiteralUnescaped(`"`)
+
+	case typ == "bool":
+		c.w.WriteStatementStart(true, "if", expr.Contents)
+		c.w.WriteLiteralUnescapedf(" %s", name)
+		c.w.WriteBlockEnd(true)
+
+	case runtime.IsBooleanAttribute(name):
+		c.w.WriteStatementStart(true, "if", isPresent(expr.Contents, typ))
+		c.w.WriteLiteralUnescapedf(" %s", name)
+		c.w.WriteBlockEnd(true)
+
+	case typ != "string" && ectx == contextAttr && expr.Escape:
+		// The runtime also writes only the name if the value is true
+		c.w.WriteAttribute(name, expr.Contents)
+
+	default:
+		c.w.WriteStatementStart(true, "if", attrValueVar+" := "+expr.Contents+"; "+isPresent(attrValueVar, typ))
+
+		exit := c.enterScope()
+		c.vars[attrValueVar] = typ
+
+		c.w.WriteLiteralUnescapedf(` %s="`, name)
+		c.visitValue(ast.ValueGoExpr{
+			Pos:      expr.Pos,
+			Contents: attrValueVar,
+			Escape:   expr.Escape,
+		}, ectx)
+		c.w.WriteLiteralUnescaped(`"`)
+
+		exit()
+		c.w.WriteBlockEnd(true)
+	}
+}
+
+// isPresent returns a Go expression that checks whether an attribute whose
+// value is expr, of type typ, should be written.
+func isPresent(expr, typ string) string {
+	if typ == "string" {
+		return expr + ` != ""`
+	}
+	return "!poodle.OmitAttribute(" + expr + ")"
+}
+
+// attributesValue returns a Go expression whose result is attrs as
+// poodle.Attributes, or nil if there are none.
+func (c *context) attributesValue(attrs []ast.TagAttribute) string {
+	if len(attrs) == 0 {
+		return "nil"
+	}
+
+	var elems []string
+
+	for _, attr := range attrs {
+		value := "true"
+		if attr.Value != nil {
+			value = goValue(attr.Value)
+		}
+		if attr.Condition != "" {
+			value = "poodle.When(" + attr.Condition + ", " + value + ")"
+		}
+
+		elems = append(elems, "{Name: "+strconv.Quote(attr.Name)+", Value: "+value+"}")
+	}
+
+	return "poodle.Attributes{" + strings.Join(elems, ", ") + "}"
+}
@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pipe01/poodle/internal/lexer"
+	"github.com/pipe01/poodle/internal/parser"
+	"github.com/pipe01/poodle/runtime"
+)
+
+// generate returns the code generated for the template src.
+func generate(t *testing.T, src string, opts Options) string {
+	t.Helper()
+
+	tks, err := lexer.New([]byte(src), "test.poo").Collect()
+	if err != nil {
+		t.Fatalf("lex: %s", err)
+	}
+
+	f, err := parser.Parse(tks, nil)
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+
+	var b strings.Builder
+	if err := Visit(&b, f, opts); err != nil {
+		t.Fatalf("generate: %s", err)
+	}
+
+	return b.String()
+}
+
+func TestStyleInterpolationCantAddDeclarations(t *testing.T) {
+	code := generate(t, "arg c string\np(style=\"color: @(c)\") hi\n", Options{Package: "main"})
+
+	const want = `poodle.Styles(poodle.CSS(poodle.Concat("color: ", poodle.EscapeCSSValue((c)))))`
+	if !strings.Contains(code, want) {
+		t.Fatalf("generated code doesn't contain %s:\n%s", want, code)
+	}
+
+	// Evaluate the same expression the generated code does
+	c := "red; position: fixed; top: 0"
+	got := runtime.Styles(runtime.CSS(runtime.Concat("color: ", runtime.EscapeCSSValue(c))))
+
+	if strings.Contains(got, ";") {
+		t.Errorf("style value %q has more than one declaration", got)
+	}
+	if !strings.HasPrefix(got, "color: red") {
+		t.Errorf("style value %q doesn't start with the interpolated color", got)
+	}
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"strings"
+
+	"github.com/pipe01/poodle/runtime"
+)
+
+const runtimeImport = `poodle "github.com/pipe01/poodle/runtime"`
+
+// Version of the runtime package API that generated code uses
+const runtimeVersion = runtime.MaxVersion
+
+const escapeHTML = "poodle.EscapeHTML"
+
+// escapeContext is the kind of output a Go expression is being written into,
+// it determines which escapers are applied to the expression's value.
+type escapeContext int
+
+const (
+	contextHTML escapeContext = iota
+	contextAttr
+	contextAttrURL
+	contextAttrURLPath
+	contextAttrURLQuery
+	contextAttrScript
+	contextAttrStyle
+	contextScript
+	contextStyle
+)
+
+func attributeContext(name string) escapeContext {
+	name = strings.ToLower(name)
+
+	if runtime.IsURLAttribute(name) {
+		return contextAttrURL
+	}
+
+	switch {
+	case name == "style":
+		return contextAttrStyle
+	case strings.HasPrefix(name, "on"):
+		return contextAttrScript
+	}
+
+	return contextAttr
+}
+
+func elementContext(tagName string) escapeContext {
+	switch strings.ToLower(tagName) {
+	case "script":
+		return contextScript
+	case "style":
+		return contextStyle
+	}
+
+	return contextHTML
+}
+
+// isAttribute returns whether e is the context of an attribute value.
+func (e escapeContext) isAttribute() bool {
+	switch e {
+	case contextAttr, contextAttrURL, contextAttrURLPath, contextAttrURLQuery, contextAttrScript, contextAttrStyle:
+		return true
+	}
+	return false
+}
+
+// after returns the context that follows writing the literal str, or a
+// Go expression if str is empty.
+func (e escapeContext) after(str string) escapeContext {
+	switch e {
+	case contextAttrURL, contextAttrURLPath:
+		if strings.ContainsAny(str, "?#") {
+			return contextAttrURLQuery
+		}
+
+		// Once something has been written the scheme can't be changed
+		return contextAttrURLPath
+	}
+
+	return e
+}
+
+// escapers returns the names of the functions that need to be applied, in
+// order, to a value written in this context.
+func (e escapeContext) escapers() []string {
+	switch e {
+	case contextAttrURL:
+		return []string{"poodle.EscapeURL", escapeHTML}
+	case contextAttrURLPath:
+		return []string{"poodle.NormalizeURL", escapeHTML}
+	case contextAttrURLQuery:
+		return []string{"poodle.EscapeURLComponent", escapeHTML}
+	case contextAttrScript:
+		return []string{"poodle.EscapeJS", escapeHTML}
+	case contextScript:
+		return []string{"poodle.EscapeJS"}
+	case contextAttrStyle, contextStyle:
+		return []string{"poodle.EscapeCSS"}
+	}
+
+	return []string{escapeHTML}
+}
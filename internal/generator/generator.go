@@ -1,7 +1,6 @@
 package generator
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"reflect"
@@ -14,8 +13,8 @@ import (
 )
 
 type GeneratorError struct {
-	Inner    error
-	Location lexer.Location
+	Inner         error
+	Location, End lexer.Location
 }
 
 func (e *GeneratorError) Unwrap() error {
@@ -30,31 +29,74 @@ func (e *GeneratorError) At() lexer.Location {
 	return e.Location
 }
 
+func (e *GeneratorError) Range() lexer.Range {
+	return lexer.Range{Start: e.Location, End: e.End}
+}
+
 type Options struct {
 	Package        string
 	ForceExport    bool
 	UseBufioWriter bool
+
+	// Write an exported function for each mixin instead of a template function
+	Library bool
+
+	// Write //line directives so that compiler errors, panics and stack traces
+	// point to the template source instead of the generated code
+	LineDirectives bool
+	// Directory that template file names are relative to, as seen from the
+	// directory that the generated file is written into
+	SourceDir string
+
+	// Make template and mixin functions return an error, which is the first
+	// error found while writing or flushing the output
+	ReturnError bool
+
+	// Add a "ctx context.Context" first parameter to template and library
+	// functions, rendering stops with ctx.Err() if it's cancelled during a
+	// loop. Implies ReturnError.
+	Context bool
+
+	// Indent the output according to the nesting of elements, inline elements
+	// and the contents of pre and textarea elements are written as they are.
+	// Library functions don't know where they're called from, so their output
+	// is indented as if they were called at the top level.
+	Pretty bool
 }
 
 type context struct {
 	w    *outputWriter
 	opts Options
 
-	mixins map[string]*ast.NodeMixinDef
+	mixins map[string]*mixin
+
+	// Context that text nodes are currently being written into
+	textContext escapeContext
+
+	// Variables visible from the code currently being written
+	vars scope
 
-	mixinCallStack []*ast.NodeMixinDef
+	pretty prettyState
 }
 
 func Visit(w io.Writer, f *ast.File, opts Options) error {
+	if opts.Context {
+		opts.ReturnError = true
+	}
+
 	outw := &outputWriter{
-		w: w,
+		w:              w,
+		lineDirectives: opts.LineDirectives,
+		sourceDir:      opts.SourceDir,
+		returnErrors:   opts.ReturnError,
 	}
 	defer outw.Close()
 
 	ctx := context{
 		w:      outw,
 		opts:   opts,
-		mixins: make(map[string]*ast.NodeMixinDef),
+		mixins: make(map[string]*mixin),
+		vars:   make(scope),
 	}
 
 	return ctx.visitFile(f)
@@ -62,9 +104,12 @@ func Visit(w io.Writer, f *ast.File, opts Options) error {
 
 func (c *context) visitFile(f *ast.File) error {
 	importsMap := map[string]struct{}{
-		`"bufio"`: {},
-		`"io"`:    {},
-		`"html"`:  {},
+		`"bufio"`:     {},
+		`"io"`:        {},
+		runtimeImport: {},
+	}
+	if c.opts.Context {
+		importsMap[`"context"`] = struct{}{}
 	}
 	for _, i := range f.Imports {
 		importsMap[i] = struct{}{}
@@ -75,9 +120,13 @@ func (c *context) visitFile(f *ast.File) error {
 
 	c.w.WriteFileHeader(c.opts.Package, imports)
 
+	if c.opts.Library {
+		return c.visitLibrary(f)
+	}
+
 	name := f.Name
 	if c.opts.ForceExport {
-		name = strings.ToUpper(name[:1]) + name[1:]
+		name = exportName(name)
 	}
 
 	args := f.Args
@@ -86,33 +135,43 @@ func (c *context) visitFile(f *ast.File) error {
 	} else {
 		args = append([]string{"iw io.Writer"}, args...)
 	}
+	if c.opts.Context {
+		args = append([]string{"ctx context.Context"}, args...)
+	}
 
 	c.w.WriteFuncHeader(name, args)
+	c.declareArgs(f.Args)
 
 	if !c.opts.UseBufioWriter {
-		c.w.add(&InstructionBufioWriter{})
+		c.w.add(&InstructionBufioWriter{
+			DeferFlush: !c.opts.ReturnError,
+		})
 	}
 
-	err := c.visitNodes(f.Nodes)
+	c.collectMixins(f.Nodes)
+
+	err := c.visitMixinDefs(f.Nodes)
 	if err != nil {
 		return err
 	}
 
-	c.w.WriteBlockEnd(true)
+	err = c.visitNodes(f.Nodes)
+	if err != nil {
+		return err
+	}
+
+	// Flush the writer if it was created here, so that its error is returned
+	if c.opts.UseBufioWriter {
+		c.w.WriteFuncEnd("nil")
+	} else {
+		c.w.WriteFuncEnd("w.Flush()")
+	}
 	return nil
 }
 
 func (c *context) visitNodes(nodes []ast.Node) error {
 	var err error
 
-	// First pass to find mixin definitions, this way they can be used before being defined
-	for _, n := range nodes {
-		switch n := n.(type) {
-		case *ast.NodeMixinDef:
-			c.mixins[n.Name] = n
-		}
-	}
-
 	for _, n := range nodes {
 		err = c.visitNode(n)
 		if err != nil {
@@ -124,18 +183,23 @@ func (c *context) visitNodes(nodes []ast.Node) error {
 }
 
 func (c *context) visitNode(n ast.Node) error {
+	c.w.SetPosition(n.Position())
+
 	switch n := n.(type) {
 	case *ast.NodeComment:
+		c.writeLineBreak()
 		c.visitNodeComment(n)
 
 	case *ast.NodeDoctype:
+		c.writeLineBreak()
 		c.w.WriteLiteralUnescapedf("<!DOCTYPE %s>", n.Value)
 
 	case *ast.NodeTag:
 		return c.visitNodeTag(n)
 
 	case *ast.NodeText:
-		c.visitValue(n.Text)
+		c.pretty.wroteOutput, c.pretty.skipLineBreak = true, false
+		return c.visitText(n.Text)
 
 	case *ast.NodeGoStatement:
 		return c.visitNodeGoStatement(n)
@@ -143,17 +207,27 @@ func (c *context) visitNode(n ast.Node) error {
 	case *ast.NodeGoBlock:
 		c.visitNodeGoBlock(n)
 
+	case *ast.NodeGoLine:
+		c.w.WriteGoLine(n.Contents)
+		c.declareStatement(n.Contents)
+
 	case *ast.NodeMixinCall:
 		return c.visitNodeMixinCall(n)
 
 	case *ast.NodeInclude:
 		return c.visitNodes(n.File.Nodes)
 
-	case *ast.NodeMixinDef:
-		// Skip, already handled in visitFile
+	case *ast.NodeBlock:
+		return c.visitNodes(n.Nodes)
+
+	case *ast.NodeMixinSlot:
+		return c.visitNodeMixinSlot(n)
+
+	case *ast.NodeMixinDef, *ast.NodeUse:
+		// Skip, already handled in visitMixinDefs
 
 	default:
-		return errorAt(fmt.Errorf("unknown node type %s", reflect.ValueOf(n).String()), n.Position())
+		return errorAt(fmt.Errorf("unknown node type %s", reflect.ValueOf(n).String()), n.Range())
 	}
 
 	return nil
@@ -164,27 +238,27 @@ func (c *context) visitNodeComment(n *ast.NodeComment) {
 }
 
 func (c *context) visitNodeTag(n *ast.NodeTag) error {
-	c.w.WriteLiteralUnescapedf("<%s", n.Name)
-
-	for _, attr := range n.Attributes {
-		if attr.Condition != "" {
-			c.w.WriteStatementStart(true, "if", attr.Condition)
-		}
+	isBlock := !isInlineElement(n.Name)
+	if isBlock && !n.TrimOuter {
+		c.writeLineBreak()
+	}
+	c.pretty.wroteOutput, c.pretty.skipLineBreak = true, false
 
-		c.w.WriteLiteralUnescapedf(` %s="`, attr.Name)
-		c.visitValue(attr.Value)
-		c.w.WriteLiteralUnescaped(`"`)
+	c.w.WriteLiteralUnescapedf("<%s", n.Name)
 
-		if attr.Condition != "" {
-			c.w.WriteBlockEnd(true)
-		}
-	}
+	c.visitAttributes(n.Attributes, n.SpreadAttributes)
 
 	if n.IsSelfClosing {
 		c.w.WriteLiteralUnescaped("/>")
 	} else {
 		c.w.WriteLiteralUnescaped(">")
 
+		prevContext, prevPreformatted := c.textContext, c.pretty.preformatted
+		c.textContext = elementContext(n.Name)
+		c.pretty.preformatted = c.pretty.preformatted || isPreformatted(n.Name)
+		c.pretty.depth++
+		c.pretty.skipLineBreak = n.TrimInner
+
 		for _, n := range n.Nodes {
 			err := c.visitNode(n)
 			if err != nil {
@@ -192,14 +266,53 @@ func (c *context) visitNodeTag(n *ast.NodeTag) error {
 			}
 		}
 
+		c.pretty.depth--
+		c.textContext, c.pretty.preformatted = prevContext, prevPreformatted
+
+		if isBlock && !n.TrimInner && !isPreformatted(n.Name) && hasBlockContent(n.Nodes) {
+			c.writeLineBreak()
+		}
 		c.w.WriteLiteralUnescapedf("</%s>", n.Name)
 	}
 
+	c.pretty.skipLineBreak = n.TrimOuter
+
 	return nil
 }
 
 func (c *context) visitNodeGoStatement(n *ast.NodeGoStatement) error {
-	c.w.WriteStatementStart(!n.HasElse, string(n.Keyword), n.Argument)
+	switch n.Keyword {
+	case ast.KeywordCase, ast.KeywordDefault:
+		c.w.WriteCaseStart(string(n.Keyword), n.Argument)
+		if err := c.visitNodes(n.Nodes); err != nil {
+			return err
+		}
+		c.w.indent(-1)
+
+		return nil
+	}
+
+	// Else statements are written on the same line as the previous block's end
+	isElse := n.Keyword == ast.KeywordElse || n.Keyword == ast.KeywordElseIf
+
+	// Variables declared in an if statement are also visible in the else
+	// branches that follow it
+	switch n.Keyword {
+	case ast.KeywordIf, ast.KeywordElseIf:
+		c.declareStatement("if " + n.Argument + " {}")
+	}
+
+	exit := c.enterScope()
+	defer exit()
+
+	if n.Keyword == ast.KeywordFor || n.Keyword == ast.KeywordSwitch {
+		c.declareStatement(string(n.Keyword) + " " + n.Argument + " {}")
+	}
+
+	c.w.WriteStatementStart(!isElse, string(n.Keyword), n.Argument)
+	if n.Keyword == ast.KeywordFor && c.opts.Context {
+		c.w.WriteGoLine("if err := ctx.Err(); err != nil {\nreturn err\n}")
+	}
 	if err := c.visitNodes(n.Nodes); err != nil {
 		return err
 	}
@@ -209,70 +322,75 @@ func (c *context) visitNodeGoStatement(n *ast.NodeGoStatement) error {
 }
 
 func (c *context) visitNodeGoBlock(n *ast.NodeGoBlock) {
-	c.w.WriteGoBlock(n.Contents)
+	c.w.WriteGoBlock(n.Contents, n.Position())
+	c.declareStatement(n.Contents)
 }
 
-func (c *context) visitNodeMixinCall(n *ast.NodeMixinCall) error {
-	mixinDef, ok := c.mixins[n.Name]
-	if !ok {
-		return errorAt(fmt.Errorf("mixin %q not found", n.Name), n.Position())
-	}
-
-	if slices.Contains(c.mixinCallStack, mixinDef) {
-		return errorAt(errors.New("recursive mixins are not allowed"), n.Position())
-	}
-
-	if len(n.Args) != len(mixinDef.Args) {
-		return errorAt(fmt.Errorf("mixin %q needs %d argument but %d were passed", n.Name, len(mixinDef.Args), len(n.Args)), n.Position())
-	}
-
-	hasArgs := len(mixinDef.Args) > 0
-	if hasArgs {
-		c.w.WriteBlockStart()
-	}
-
-	for i, arg := range mixinDef.Args {
-		c.w.WriteVariable(arg.Name, arg.Type, n.Args[i])
-	}
+// visitText writes the contents of a text node, writing the elements inside of
+// it in place.
+func (c *context) visitText(v ast.Value) error {
+	switch v := v.(type) {
+	case ast.ValueTag:
+		// Inline elements are never indented, like the contents of a pre
+		prevPreformatted := c.pretty.preformatted
+		c.pretty.preformatted = true
+		defer func() { c.pretty.preformatted = prevPreformatted }()
 
-	c.mixinCallStack = append(c.mixinCallStack, mixinDef)
-	if err := c.visitNodes(mixinDef.Nodes); err != nil {
-		return err
-	}
-	c.mixinCallStack = c.mixinCallStack[:len(c.mixinCallStack)-1]
+		return c.visitNodeTag(v.Tag)
 
-	if hasArgs {
-		c.w.WriteBlockEnd(true)
+	case ast.ValueConcat:
+		if err := c.visitText(v.A); err != nil {
+			return err
+		}
+		return c.visitText(v.B)
 	}
 
+	c.visitValue(v, c.textContext)
 	return nil
 }
 
-func (c *context) visitValue(v ast.Value) {
+// visitValue writes v escaped for the ectx context, and returns the context
+// that the next value would be written into.
+func (c *context) visitValue(v ast.Value, ectx escapeContext) escapeContext {
 	switch v := v.(type) {
 	case ast.ValueLiteral:
-		c.w.WriteLiteralUnescapedf(`%s`, v.Contents)
+		contents := v.Contents
+		if ectx.isAttribute() {
+			// Attribute values are always written in double quotes
+			contents = strings.ReplaceAll(contents, `"`, "&#34;")
+		}
+
+		c.w.WriteLiteralUnescaped(contents)
+		return ectx.after(v.Contents)
 
 	case ast.ValueGoExpr:
-		if v.EscapeHTML {
-			c.w.WriteGoEscaped(v.Contents)
+		c.w.SetPosition(v.Position())
+
+		typ := c.exprType(v.Contents)
+
+		if v.Escape {
+			c.w.WriteGoEscaped(v.Contents, typ, ectx.escapers())
 		} else {
-			c.w.WriteGoUnescaped(v.Contents)
+			c.w.WriteGoUnescaped(v.Contents, typ)
 		}
+		return ectx.after("")
 
 	case ast.ValueConcat:
-		c.visitValue(v.A)
-		c.visitValue(v.B)
+		ectx = c.visitValue(v.A, ectx)
+		return c.visitValue(v.B, ectx)
 	}
+
+	return ectx
 }
 
-func mixinFuncName(mixinName string) string {
-	return "_mixin_" + mixinName
+func exportName(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
 }
 
-func errorAt(err error, pos lexer.Location) error {
+func errorAt(err error, rng lexer.Range) error {
 	return &GeneratorError{
 		Inner:    err,
-		Location: pos,
+		Location: rng.Start,
+		End:      rng.End,
 	}
 }
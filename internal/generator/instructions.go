@@ -3,6 +3,7 @@ package generator
 import (
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 )
 
@@ -11,10 +12,16 @@ type Instruction interface {
 }
 
 type InstructionBufioWriter struct {
+	// If false, the writer must be flushed explicitly
+	DeferFlush bool
 }
 
 func (i *InstructionBufioWriter) WriteTo(w io.Writer) {
-	fmt.Fprint(w, "w := bufio.NewWriter(iw); defer w.Flush()\n")
+	if i.DeferFlush {
+		fmt.Fprint(w, "w := poodle.AcquireWriter(iw); defer poodle.ReleaseWriter(w); defer w.Flush()\n")
+	} else {
+		fmt.Fprint(w, "w := poodle.AcquireWriter(iw); defer poodle.ReleaseWriter(w)\n")
+	}
 }
 
 type InstructionIndentation struct {
@@ -41,11 +48,18 @@ import (
 	}
 
 	fmt.Fprint(w, ")\n\n")
+
+	fmt.Fprintf(w, `// Fail to compile if the poodle runtime is too old or too new for this file
+const _ = poodle.EnforceVersion(poodle.MaxVersion - %d)
+const _ = poodle.EnforceVersion(%d - poodle.MinVersion)
+
+`, runtimeVersion, runtimeVersion)
 }
 
 type InstructionWriteFuncHeader struct {
-	Name string
-	Args []string
+	Name   string
+	Args   []string
+	Result string
 }
 
 func (i *InstructionWriteFuncHeader) WriteTo(w io.Writer) {
@@ -55,32 +69,115 @@ func (i *InstructionWriteFuncHeader) WriteTo(w io.Writer) {
 		w.Write([]byte(strings.Join(i.Args, ", ")))
 	}
 
-	fmt.Fprint(w, ") {\n")
+	if i.Result != "" {
+		fmt.Fprintf(w, ") %s {\n", i.Result)
+	} else {
+		fmt.Fprint(w, ") {\n")
+	}
 }
 
 type InstructionLiteral struct {
-	String string
+	String     string
+	CheckError bool
 }
 
 func (i *InstructionLiteral) WriteTo(w io.Writer) {
-	writeLiteral(w, i.String)
+	writeLiteral(w, i.String, i.CheckError)
 }
 
-func writeLiteral(w io.Writer, str string) {
-	fmt.Fprintf(w, "w.WriteString(%q)\n", str)
+func writeLiteral(w io.Writer, str string, checkErr bool) {
+	writeWrite(w, fmt.Sprintf("w.WriteString(%q)", str), checkErr)
+}
+
+// writeWrite writes call, a call to a function that writes to the output. If
+// checkErr is true, the error it returns is returned from the current function.
+func writeWrite(w io.Writer, call string, checkErr bool) {
+	if checkErr {
+		fmt.Fprintf(w, "if _, err := %s; err != nil {\nreturn err\n}\n", call)
+	} else {
+		fmt.Fprintf(w, "%s\n", call)
+	}
 }
 
 type InstructionGo struct {
-	Value      string
-	HTMLEscape bool
+	Value string
+
+	// Go type of the value, or empty if it's not known
+	Type string
+
+	// Functions to pass the value through, in order
+	Escapers []string
+
+	CheckError bool
 }
 
 func (i *InstructionGo) WriteTo(w io.Writer) {
-	if i.HTMLEscape {
-		fmt.Fprintf(w, "w.WriteString(html.EscapeString(fmt.Sprint(%s)))\n", i.Value)
-	} else {
-		fmt.Fprintf(w, "fmt.Fprint(w, %s)\n", i.Value)
+	writeWrite(w, i.call(), i.CheckError)
+}
+
+// call returns the call that writes the value. Strings that are only HTML
+// escaped are written by the runtime without allocating, and values of unknown
+// types go through its type switch before falling back to fmt. Numbers and
+// booleans never need to be escaped.
+func (i *InstructionGo) call() string {
+	switch {
+	case i.Type == "int64":
+		return fmt.Sprintf("poodle.WriteInt(w, %s)", i.Value)
+	case isIntType(i.Type):
+		return fmt.Sprintf("poodle.WriteInt(w, int64(%s))", i.Value)
+	case i.Type == "uint64":
+		return fmt.Sprintf("poodle.WriteUint(w, %s)", i.Value)
+	case isUintType(i.Type):
+		return fmt.Sprintf("poodle.WriteUint(w, uint64(%s))", i.Value)
+	case i.Type == "bool":
+		return fmt.Sprintf("poodle.WriteBool(w, %s)", i.Value)
+	}
+
+	switch {
+	case len(i.Escapers) == 0 && i.Type == "string":
+		return fmt.Sprintf("w.WriteString(%s)", i.Value)
+	case len(i.Escapers) == 0:
+		return fmt.Sprintf("poodle.Write(w, %s)", i.Value)
+
+	case len(i.Escapers) == 1 && i.Escapers[0] == escapeHTML && i.Type == "string":
+		return fmt.Sprintf("poodle.WriteHTMLString(w, %s)", i.Value)
+	case len(i.Escapers) == 1 && i.Escapers[0] == escapeHTML:
+		return fmt.Sprintf("poodle.WriteHTML(w, %s)", i.Value)
 	}
+
+	expr := i.Value
+	for _, e := range i.Escapers {
+		expr = fmt.Sprintf("%s(%s)", e, expr)
+	}
+
+	return fmt.Sprintf("w.WriteString(%s)", expr)
+}
+
+type InstructionAttribute struct {
+	Name  string
+	Value string
+
+	CheckError bool
+}
+
+func (i *InstructionAttribute) WriteTo(w io.Writer) {
+	writeWrite(w, fmt.Sprintf("poodle.WriteAttribute(w, %q, %s)", i.Name, i.Value), i.CheckError)
+}
+
+type InstructionAttributes struct {
+	Value string
+	Skip  []string
+
+	CheckError bool
+}
+
+func (i *InstructionAttributes) WriteTo(w io.Writer) {
+	args := []string{"w", i.Value}
+	for _, name := range i.Skip {
+		args = append(args, strconv.Quote(name))
+	}
+
+	writeWrite(w, fmt.Sprintf("poodle.WriteAttributes(%s)", strings.Join(args, ", ")), i.CheckError)
 }
 
 type InstructionStatementStart struct {
@@ -96,12 +193,85 @@ func (i *InstructionStatementStart) WriteTo(w io.Writer) {
 	}
 }
 
+type InstructionCaseStart struct {
+	Keyword string
+	Arg     string
+}
+
+func (i *InstructionCaseStart) WriteTo(w io.Writer) {
+	if i.Arg == "" {
+		fmt.Fprintf(w, "%s:\n", i.Keyword)
+	} else {
+		fmt.Fprintf(w, "%s %s:\n", i.Keyword, i.Arg)
+	}
+}
+
 type InstructionVariable struct {
 	Name, Type, Value string
 }
 
 func (i *InstructionVariable) WriteTo(w io.Writer) {
-	fmt.Fprintf(w, "var %s %s = %s; _ = %s\n", i.Name, i.Type, i.Value, i.Name)
+	if i.Value == "" {
+		fmt.Fprintf(w, "var %s %s\n", i.Name, i.Type)
+	} else {
+		fmt.Fprintf(w, "var %s %s = %s; _ = %s\n", i.Name, i.Type, i.Value, i.Name)
+	}
+}
+
+type InstructionFuncLiteral struct {
+	Name, Args, Result string
+}
+
+func (i *InstructionFuncLiteral) WriteTo(w io.Writer) {
+	if i.Result != "" {
+		fmt.Fprintf(w, "%s = func(%s) %s {\n", i.Name, i.Args, i.Result)
+	} else {
+		fmt.Fprintf(w, "%s = func(%s) {\n", i.Name, i.Args)
+	}
+}
+
+type InstructionCallStart struct {
+	Func string
+	Args []string
+
+	// If true, the error returned by the function is returned from the
+	// current function. The call must be ended with an InstructionCallEnd
+	// with the same value.
+	CheckError bool
+}
+
+func (i *InstructionCallStart) WriteTo(w io.Writer) {
+	if i.CheckError {
+		fmt.Fprint(w, "if err := ")
+	}
+	fmt.Fprintf(w, "%s(%s", i.Func, strings.Join(i.Args, ", "))
+}
+
+type InstructionCallArg struct {
+	Value string
+}
+
+func (i *InstructionCallArg) WriteTo(w io.Writer) {
+	fmt.Fprintf(w, ", %s", i.Value)
+}
+
+type InstructionFuncLiteralArgEnd struct {
+}
+
+func (i *InstructionFuncLiteralArgEnd) WriteTo(w io.Writer) {
+	fmt.Fprint(w, "}")
+}
+
+type InstructionCallEnd struct {
+	CheckError bool
+}
+
+func (i *InstructionCallEnd) WriteTo(w io.Writer) {
+	if i.CheckError {
+		fmt.Fprint(w, "); err != nil {\nreturn err\n}\n")
+	} else {
+		fmt.Fprint(w, ")\n")
+	}
 }
 
 type InstructionBlockStart struct {
@@ -131,3 +301,20 @@ func (i *InstructionGoLine) WriteTo(w io.Writer) {
 	w.Write(i.Content)
 	w.Write([]byte{'\n'})
 }
+
+type InstructionLineDirective struct {
+	File         string
+	Line, Column int
+
+	// If true the directive is written in the middle of a line, applying to the
+	// code right after it
+	Inline bool
+}
+
+func (i *InstructionLineDirective) WriteTo(w io.Writer) {
+	if i.Inline {
+		fmt.Fprintf(w, "/*line %s:%d:%d*/", i.File, i.Line, i.Column)
+	} else {
+		fmt.Fprintf(w, "//line %s:%d:%d\n", i.File, i.Line, i.Column)
+	}
+}
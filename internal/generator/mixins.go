@@ -0,0 +1,396 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pipe01/poodle/internal/parser/ast"
+	"golang.org/x/exp/slices"
+)
+
+// Name of the parameter that holds the attributes passed to a mixin
+const mixinAttributesParam = "attributes"
+
+var mixinAttributesRegexp = regexp.MustCompile(`\b` + mixinAttributesParam + `\b`)
+
+type mixin struct {
+	def *ast.NodeMixinDef
+
+	// Name of the Go function or closure that renders the mixin
+	funcName string
+
+	// Whether the mixin is rendered by a closure declared inside the
+	// template function, otherwise it's a package level function
+	isClosure bool
+}
+
+// collectMixins finds all the mixins defined in nodes and the files they use,
+// this way they can be used before being defined.
+func (c *context) collectMixins(nodes []ast.Node) {
+	ast.Inspect(nodes, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.NodeMixinDef:
+			m := &mixin{
+				def:       n,
+				funcName:  mixinFuncName(n.Name),
+				isClosure: true,
+			}
+			if c.opts.Library {
+				m.funcName = exportName(n.Name)
+				m.isClosure = false
+			}
+
+			c.mixins[n.Name] = m
+
+		case *ast.NodeUse:
+			c.collectUsedMixins(n)
+		}
+		return true
+	})
+}
+
+func (c *context) collectUsedMixins(use *ast.NodeUse) {
+	pkgName := use.GoPackageName()
+
+	for _, n := range use.File.Nodes {
+		switch n := n.(type) {
+		case *ast.NodeMixinDef:
+			m := &mixin{
+				def:       n,
+				funcName:  mixinFuncName(n.Name),
+				isClosure: true,
+			}
+			if use.GoPackage != "" {
+				m.funcName = pkgName + "." + exportName(n.Name)
+				m.isClosure = false
+			}
+
+			c.mixins[n.Name] = m
+
+		case *ast.NodeUse:
+			// Libraries take care of their own dependencies
+			if use.GoPackage == "" {
+				c.collectUsedMixins(n)
+			}
+		}
+	}
+}
+
+// visitMixinDefs writes a closure for each mixin that is called from nodes,
+// either directly or through other mixins. The closures are declared before
+// being assigned so that mixins can call themselves and each other.
+func (c *context) visitMixinDefs(nodes []ast.Node) error {
+	var used []*mixin
+
+	var findCalls func(nodes []ast.Node)
+	findCalls = func(nodes []ast.Node) {
+		ast.Inspect(nodes, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.NodeMixinDef:
+				return false
+
+			case *ast.NodeMixinCall:
+				m, ok := c.mixins[n.Name]
+				if ok && m.isClosure && !slices.Contains(used, m) {
+					used = append(used, m)
+					findCalls(m.def.Nodes)
+				}
+			}
+			return true
+		})
+	}
+	findCalls(nodes)
+
+	for _, m := range used {
+		c.w.WriteVariableDecl(m.funcName, strings.TrimSpace("func("+strings.Join(c.mixinClosureArgs(m.def), ", ")+") "+c.w.funcResult()))
+	}
+
+	prevContext, prevPretty := c.textContext, c.pretty
+	defer func() { c.textContext, c.pretty = prevContext, prevPretty }()
+
+	for _, m := range used {
+		// Mixins can be called from anywhere, so there's no way to know
+		// what element they'll be written into or how deep it is
+		c.textContext = contextHTML
+		c.pretty = prettyState{inMixin: true, wroteOutput: true}
+
+		c.w.SetPosition(m.def.Position())
+		c.w.WriteFuncLiteral(m.funcName, strings.Join(c.mixinClosureArgs(m.def), ", "))
+
+		exit := c.enterScope()
+		c.declareMixinArgs(m.def)
+
+		if err := c.visitNodes(m.def.Nodes); err != nil {
+			return err
+		}
+
+		exit()
+		c.w.WriteFuncEnd("nil")
+	}
+
+	return nil
+}
+
+// visitLibrary writes a package level function for each mixin defined in f.
+func (c *context) visitLibrary(f *ast.File) error {
+	c.collectMixins(f.Nodes)
+
+	var defs []*ast.NodeMixinDef
+	ast.Inspect(f.Nodes, func(n ast.Node) bool {
+		// Skip mixins that have been redefined later
+		if def, ok := n.(*ast.NodeMixinDef); ok && c.mixins[def.Name].def == def {
+			defs = append(defs, def)
+		}
+		return true
+	})
+
+	for _, def := range defs {
+		args := c.mixinFuncArgs(def)
+		if c.opts.Context {
+			args = append([]string{"ctx context.Context"}, args...)
+		}
+
+		c.w.WriteFuncHeader(exportName(def.Name), args)
+
+		// The indentation of the call site isn't passed to library functions,
+		// since the caller can't know whether they were pretty printed
+		c.pretty = prettyState{}
+		c.vars = make(scope)
+		c.declareMixinArgs(def)
+
+		if err := c.visitMixinDefs(def.Nodes); err != nil {
+			return err
+		}
+		if err := c.visitNodes(def.Nodes); err != nil {
+			return err
+		}
+
+		c.w.WriteFuncEnd("nil")
+	}
+
+	return nil
+}
+
+func (c *context) visitNodeMixinCall(n *ast.NodeMixinCall) error {
+	m, ok := c.mixins[n.Name]
+	if !ok {
+		return errorAt(fmt.Errorf("mixin %q not found", n.Name), n.Range())
+	}
+	mixinDef := m.def
+
+	if len(n.Args) != len(mixinDef.Args) {
+		return errorAt(fmt.Errorf("mixin %q needs %d argument but %d were passed", n.Name, len(mixinDef.Args), len(n.Args)), n.Range())
+	}
+
+	usesAttributes := mixinUsesAttributes(mixinDef)
+	if len(n.Attributes) > 0 && !usesAttributes {
+		return errorAt(fmt.Errorf("mixin %q doesn't use its attributes", n.Name), n.Range())
+	}
+
+	blockNames := mixinBlockNames(mixinDef)
+
+	blocks := make(map[string][]ast.Node)
+	for _, n := range n.Nodes {
+		name := ""
+		if b, ok := n.(*ast.NodeBlock); ok {
+			name = b.Name
+		}
+
+		if !slices.Contains(blockNames, name) {
+			if name == "" {
+				return errorAt(fmt.Errorf("mixin %q doesn't have an unnamed block", mixinDef.Name), n.Range())
+			}
+			return errorAt(fmt.Errorf("mixin %q doesn't have a block named %q", mixinDef.Name, name), n.Range())
+		}
+
+		if b, ok := n.(*ast.NodeBlock); ok {
+			blocks[name] = append(blocks[name], b.Nodes...)
+		} else {
+			blocks[name] = append(blocks[name], n)
+		}
+	}
+
+	args := append([]string{"w"}, n.Args...)
+	if c.opts.Pretty && m.isClosure {
+		args = append([]string{"w", c.mixinIndentArg()}, n.Args...)
+	}
+	if usesAttributes {
+		args = append(args, c.attributesValue(n.Attributes))
+	}
+	if c.opts.Context && !m.isClosure {
+		// Package level functions don't have access to the template's context
+		args = append([]string{"ctx"}, args...)
+	}
+
+	c.w.WriteCallStart(m.funcName, args)
+
+	for _, name := range blockNames {
+		contents, ok := blocks[name]
+		if !ok {
+			c.w.WriteCallArg("nil")
+			continue
+		}
+
+		// Blocks are usually placed inside of the mixin's root element, so
+		// that's how deep they are assumed to be when pretty printing
+		c.pretty.depth++
+		exit := c.enterScope()
+		c.w.WriteFuncLiteralArg()
+		if err := c.visitNodes(contents); err != nil {
+			return err
+		}
+		c.w.WriteFuncLiteralArgEnd()
+		exit()
+		c.pretty.depth--
+	}
+
+	c.w.WriteCallEnd()
+
+	return nil
+}
+
+func (c *context) visitNodeMixinSlot(n *ast.NodeMixinSlot) error {
+	name := blockParamName(n.Name)
+
+	c.w.WriteStatementStart(true, "if", name+" != nil")
+	c.w.WriteCallStart(name, nil)
+	c.w.WriteCallEnd()
+
+	if len(n.Nodes) == 0 {
+		c.w.WriteBlockEnd(true)
+		return nil
+	}
+
+	c.w.WriteBlockEnd(false)
+	c.w.WriteStatementStart(false, "else", "")
+	if err := c.visitNodes(n.Nodes); err != nil {
+		return err
+	}
+	c.w.WriteBlockEnd(true)
+
+	return nil
+}
+
+// mixinBlockNames returns the names of the blocks used in def, in the order in
+// which they first appear.
+func mixinBlockNames(def *ast.NodeMixinDef) []string {
+	var names []string
+
+	ast.Inspect(def.Nodes, func(n ast.Node) bool {
+		if slot, ok := n.(*ast.NodeMixinSlot); ok && !slices.Contains(names, slot.Name) {
+			names = append(names, slot.Name)
+		}
+		return true
+	})
+
+	return names
+}
+
+func (c *context) mixinFuncArgs(def *ast.NodeMixinDef) []string {
+	args := []string{"w *bufio.Writer"}
+
+	for _, arg := range def.Args {
+		args = append(args, fmt.Sprintf("%s %s", arg.Name, arg.Type))
+	}
+	if mixinUsesAttributes(def) {
+		args = append(args, mixinAttributesParam+" poodle.Attributes")
+	}
+	for _, name := range mixinBlockNames(def) {
+		args = append(args, fmt.Sprintf("%s %s", blockParamName(name), c.w.blockFuncType()))
+	}
+
+	return args
+}
+
+func (c *context) declareMixinArgs(def *ast.NodeMixinDef) {
+	for _, arg := range def.Args {
+		c.vars[arg.Name] = arg.Type
+	}
+	if mixinUsesAttributes(def) {
+		c.vars[mixinAttributesParam] = "poodle.Attributes"
+	}
+}
+
+// mixinUsesAttributes returns whether any Go code in def refers to the
+// attributes passed to it, in which case they're received as a parameter.
+// Mixins defined inside def aren't looked into.
+func mixinUsesAttributes(def *ast.NodeMixinDef) bool {
+	found := false
+
+	check := func(code string) {
+		found = found || mixinAttributesRegexp.MatchString(code)
+	}
+
+	var checkValue func(v ast.Value)
+	checkValue = func(v ast.Value) {
+		switch v := v.(type) {
+		case ast.ValueGoExpr:
+			check(v.Contents)
+		case ast.ValueConcat:
+			checkValue(v.A)
+			checkValue(v.B)
+		}
+	}
+	checkAttributes := func(attrs []ast.TagAttribute) {
+		for _, attr := range attrs {
+			checkValue(attr.Value)
+			check(attr.Condition)
+		}
+	}
+
+	ast.Inspect(def.Nodes, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.NodeMixinDef:
+			return false
+
+		case *ast.NodeTag:
+			check(n.SpreadAttributes)
+			checkAttributes(n.Attributes)
+
+		case *ast.NodeText:
+			checkValue(n.Text)
+
+		case *ast.NodeGoStatement:
+			check(n.Argument)
+
+		case *ast.NodeGoBlock:
+			check(n.Contents)
+
+		case *ast.NodeGoLine:
+			check(n.Contents)
+
+		case *ast.NodeMixinCall:
+			for _, arg := range n.Args {
+				check(arg)
+			}
+			checkAttributes(n.Attributes)
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+// mixinClosureArgs returns the arguments of the closure that renders def,
+// which also receives the indentation of its call site when pretty printing.
+func (c *context) mixinClosureArgs(def *ast.NodeMixinDef) []string {
+	args := c.mixinFuncArgs(def)
+	if c.opts.Pretty {
+		args = append([]string{args[0], prettyIndentParam + " string"}, args[1:]...)
+	}
+
+	return args
+}
+
+func mixinFuncName(mixinName string) string {
+	return "_mixin_" + mixinName
+}
+
+func blockParamName(blockName string) string {
+	if blockName == "" {
+		return "_block"
+	}
+	return "_block_" + blockName
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"html"
 	"io"
+	"path/filepath"
 	"strings"
+
+	"github.com/pipe01/poodle/internal/lexer"
 )
 
 type outputWriter struct {
@@ -13,6 +16,18 @@ type outputWriter struct {
 	indentation int
 
 	instrs []Instruction
+
+	// If true, functions return the first error found while writing
+	returnErrors bool
+
+	// If true, a line directive is written before each line of Go code, since
+	// the lines between them are counted from the last one. The directive's
+	// column is the exact start of the node, which lets errors be mapped back
+	// to it. Go expressions from the template are also preceded by an inline
+	// directive, so that errors point to their exact column.
+	lineDirectives bool
+	sourceDir      string
+	pos            lexer.Location
 }
 
 func (w *outputWriter) add(i Instruction) {
@@ -23,7 +38,59 @@ func (w *outputWriter) indent(delta int) {
 	w.indentation += delta
 }
 
+// SetPosition sets the template position that the following instructions
+// originate from.
+func (w *outputWriter) SetPosition(loc lexer.Location) {
+	w.pos = loc
+}
+
+func (w *outputWriter) writeLineDirective(inline bool) {
+	if d := w.lineDirective(inline); d != nil {
+		w.add(d)
+	}
+}
+
+// lineDirective returns a directive for the current position, or nil if they
+// aren't enabled or the position isn't known.
+func (w *outputWriter) lineDirective(inline bool) *InstructionLineDirective {
+	if !w.lineDirectives || w.pos.File == "" {
+		return nil
+	}
+
+	return &InstructionLineDirective{
+		File:   filepath.ToSlash(filepath.Join(w.sourceDir, w.pos.File)),
+		Line:   w.pos.Line + 1,
+		Column: w.pos.Column + 1,
+		Inline: inline,
+	}
+}
+
+// goExpr returns expr, a Go expression from the current template position,
+// preceded by an inline line directive if they're enabled. The directive is
+// followed by a space, since gofmt would add it anyway, and wrapped in
+// parentheses along with expr so that gofmt doesn't move it before a comma.
+func (w *outputWriter) goExpr(expr string) string {
+	d := w.lineDirective(true)
+	if d == nil || d.Column <= 1 {
+		return expr
+	}
+
+	// The directive applies to the space after it
+	d.Column--
+
+	var b strings.Builder
+	b.WriteString("(")
+	d.WriteTo(&b)
+	b.WriteString(" ")
+	b.WriteString(expr)
+	b.WriteString(")")
+
+	return b.String()
+}
+
 func (w *outputWriter) writeIndentation() {
+	w.writeLineDirective(false)
+
 	w.add(&InstructionIndentation{
 		Depth: w.indentation,
 	})
@@ -32,14 +99,28 @@ func (w *outputWriter) writeIndentation() {
 func (w *outputWriter) Close() error {
 	var litBuf strings.Builder
 
+	// Line directives must start a line and literals are merged across
+	// them, so they're held back until the next Go instruction. Merged
+	// literals are written with the directive of the first one.
+	var lineDirective, litDirective *InstructionLineDirective
+
 	for i := 0; i < len(w.instrs); i++ {
 		inst := w.instrs[i]
 
 		switch inst := inst.(type) {
 		case *InstructionLiteral:
+			if litBuf.Len() == 0 {
+				litDirective = lineDirective
+			}
 			litBuf.WriteString(inst.String)
 			continue
 
+		case *InstructionLineDirective:
+			if !inst.Inline {
+				lineDirective = inst
+				continue
+			}
+
 		case *InstructionIndentation:
 			if i == len(w.instrs)-1 {
 				break
@@ -52,10 +133,22 @@ func (w *outputWriter) Close() error {
 		}
 
 		if litBuf.Len() > 0 {
-			writeLiteral(w.w, litBuf.String())
+			if litDirective != nil {
+				litDirective.WriteTo(w.w)
+				if litDirective == lineDirective {
+					lineDirective = nil
+				}
+			}
+
+			writeLiteral(w.w, litBuf.String(), w.returnErrors)
 			litBuf.Reset()
 		}
 
+		if lineDirective != nil {
+			lineDirective.WriteTo(w.w)
+			lineDirective = nil
+		}
+
 		inst.WriteTo(w.w)
 	}
 
@@ -71,16 +164,39 @@ func (w *outputWriter) WriteFileHeader(pkg string, imports []string) {
 
 func (w *outputWriter) WriteFuncHeader(name string, args []string) {
 	w.add(&InstructionWriteFuncHeader{
-		Name: name,
-		Args: args,
+		Name:   name,
+		Args:   args,
+		Result: w.funcResult(),
 	})
 
 	w.indent(1)
 }
 
+// WriteFuncEnd ends a function started with WriteFuncHeader or
+// WriteFuncLiteral. If functions return errors, result is the value returned
+// when no errors have been found.
+func (w *outputWriter) WriteFuncEnd(result string) {
+	if w.returnErrors {
+		w.WriteGoLine("return " + result)
+	}
+
+	w.WriteBlockEnd(true)
+}
+
+// funcResult returns the result type of template and mixin functions.
+func (w *outputWriter) funcResult() string {
+	if w.returnErrors {
+		return "error"
+	}
+	return ""
+}
+
 func (w *outputWriter) WriteLiteralUnescaped(str string) {
 	w.writeIndentation()
-	w.add(&InstructionLiteral{String: str})
+	w.add(&InstructionLiteral{
+		String:     str,
+		CheckError: w.returnErrors,
+	})
 }
 
 func (w *outputWriter) WriteLiteralUnescapedf(format string, a ...any) {
@@ -95,25 +211,56 @@ func (w *outputWriter) WriteLiteralEscapedf(format string, a ...any) {
 	w.WriteLiteralEscaped(fmt.Sprintf(format, a...))
 }
 
-func (w *outputWriter) WriteGoUnescaped(str string) {
+// WriteGoUnescaped writes the value of a Go expression as is. If typ isn't
+// empty, it's the type of the expression.
+func (w *outputWriter) WriteGoUnescaped(str, typ string) {
 	w.writeIndentation()
 	w.add(&InstructionGo{
-		Value:      str,
-		HTMLEscape: false,
+		Value:      w.goExpr(str),
+		Type:       typ,
+		CheckError: w.returnErrors,
 	})
 }
 
-func (w *outputWriter) WriteGoEscaped(str string) {
+// WriteGoEscaped writes the value of a Go expression after passing it through
+// escapers. If typ isn't empty, it's the type of the expression.
+func (w *outputWriter) WriteGoEscaped(str, typ string, escapers []string) {
 	w.writeIndentation()
 	w.add(&InstructionGo{
-		Value:      str,
-		HTMLEscape: true,
+		Value:      w.goExpr(str),
+		Type:       typ,
+		Escapers:   escapers,
+		CheckError: w.returnErrors,
+	})
+}
+
+// WriteAttribute writes an attribute called name whose value is the result of
+// a Go expression, leaving it out if the runtime says so.
+func (w *outputWriter) WriteAttribute(name, value string) {
+	w.writeIndentation()
+	w.add(&InstructionAttribute{
+		Name:       name,
+		Value:      w.goExpr(value),
+		CheckError: w.returnErrors,
+	})
+}
+
+// WriteAttributes writes the poodle.Attributes that are the result of a Go
+// expression, except for the ones called like any of the names in skip.
+func (w *outputWriter) WriteAttributes(value string, skip ...string) {
+	w.writeIndentation()
+	w.add(&InstructionAttributes{
+		Value:      value,
+		Skip:       skip,
+		CheckError: w.returnErrors,
 	})
 }
 
 func (w *outputWriter) WriteStatementStart(indent bool, keyword string, arg string) {
 	if indent {
 		w.writeIndentation()
+	} else {
+		w.writeLineDirective(true)
 	}
 
 	w.add(&InstructionStatementStart{
@@ -124,6 +271,18 @@ func (w *outputWriter) WriteStatementStart(indent bool, keyword string, arg stri
 	w.indent(1)
 }
 
+// WriteCaseStart starts a switch clause, it's ended by decreasing the
+// indentation.
+func (w *outputWriter) WriteCaseStart(keyword string, arg string) {
+	w.writeIndentation()
+	w.add(&InstructionCaseStart{
+		Keyword: keyword,
+		Arg:     arg,
+	})
+
+	w.indent(1)
+}
+
 func (w *outputWriter) WriteVariable(name, typ, value string) {
 	w.writeIndentation()
 	w.add(&InstructionVariable{
@@ -133,6 +292,73 @@ func (w *outputWriter) WriteVariable(name, typ, value string) {
 	})
 }
 
+func (w *outputWriter) WriteVariableDecl(name, typ string) {
+	w.writeIndentation()
+	w.add(&InstructionVariable{
+		Name: name,
+		Type: typ,
+	})
+}
+
+func (w *outputWriter) WriteFuncLiteral(name, args string) {
+	w.writeIndentation()
+	w.add(&InstructionFuncLiteral{
+		Name:   name,
+		Args:   args,
+		Result: w.funcResult(),
+	})
+	w.indent(1)
+}
+
+func (w *outputWriter) WriteCallStart(fn string, args []string) {
+	w.writeIndentation()
+	w.add(&InstructionCallStart{
+		Func:       fn,
+		Args:       args,
+		CheckError: w.returnErrors,
+	})
+}
+
+func (w *outputWriter) WriteCallArg(value string) {
+	w.add(&InstructionCallArg{
+		Value: value,
+	})
+}
+
+// WriteFuncLiteralArg starts an argument for the current call that is an
+// anonymous function, the function must be ended with WriteFuncLiteralArgEnd.
+func (w *outputWriter) WriteFuncLiteralArg() {
+	w.add(&InstructionCallArg{
+		Value: w.blockFuncType() + " {\n",
+	})
+	w.indent(1)
+}
+
+func (w *outputWriter) WriteFuncLiteralArgEnd() {
+	if w.returnErrors {
+		w.WriteGoLine("return nil")
+	}
+
+	w.indent(-1)
+	w.writeIndentation()
+	w.add(&InstructionFuncLiteralArgEnd{})
+}
+
+func (w *outputWriter) WriteCallEnd() {
+	w.add(&InstructionCallEnd{
+		CheckError: w.returnErrors,
+	})
+}
+
+// blockFuncType returns the type of the block content functions passed to
+// mixins.
+func (w *outputWriter) blockFuncType() string {
+	if w.returnErrors {
+		return "func() error"
+	}
+	return "func()"
+}
+
 func (w *outputWriter) WriteBlockStart() {
 	w.writeIndentation()
 	w.add(&InstructionBlockStart{})
@@ -146,10 +372,22 @@ func (w *outputWriter) WriteBlockEnd(newLine bool) {
 	w.add(&InstructionBlockEnd{Newline: newLine})
 }
 
-func (w *outputWriter) WriteGoBlock(contents string) {
+func (w *outputWriter) WriteGoLine(line string) {
+	w.writeIndentation()
+	w.add(&InstructionGoLine{
+		Content: []byte(line),
+	})
+}
+
+// WriteGoBlock writes each line of contents as Go code, start is the position
+// of the first line in the template.
+func (w *outputWriter) WriteGoBlock(contents string, start lexer.Location) {
 	sc := bufio.NewScanner(strings.NewReader(contents))
 
 	for sc.Scan() {
+		w.SetPosition(start)
+		start.Line++
+
 		w.writeIndentation()
 		w.add(&InstructionGoLine{
 			Content: sc.Bytes(),
@@ -0,0 +1,158 @@
+package generator
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pipe01/poodle/internal/parser/ast"
+)
+
+// String written once per nesting level when pretty printing
+const prettyIndent = "  "
+
+// Name of the parameter that holds the indentation of the place where a mixin
+// closure was called from, since that can only be known at runtime
+const prettyIndentParam = "_indent"
+
+// Elements that are written inline when pretty printing, since adding
+// whitespace around them would change how the page is rendered
+var inlineElements = map[string]struct{}{
+	"a":        {},
+	"abbr":     {},
+	"acronym":  {},
+	"b":        {},
+	"bdi":      {},
+	"bdo":      {},
+	"big":      {},
+	"br":       {},
+	"button":   {},
+	"cite":     {},
+	"code":     {},
+	"data":     {},
+	"del":      {},
+	"dfn":      {},
+	"em":       {},
+	"font":     {},
+	"i":        {},
+	"img":      {},
+	"input":    {},
+	"ins":      {},
+	"kbd":      {},
+	"label":    {},
+	"map":      {},
+	"mark":     {},
+	"meter":    {},
+	"output":   {},
+	"progress": {},
+	"q":        {},
+	"s":        {},
+	"samp":     {},
+	"select":   {},
+	"small":    {},
+	"span":     {},
+	"strike":   {},
+	"strong":   {},
+	"sub":      {},
+	"sup":      {},
+	"textarea": {},
+	"time":     {},
+	"tt":       {},
+	"u":        {},
+	"var":      {},
+	"wbr":      {},
+}
+
+func isInlineElement(tagName string) bool {
+	_, ok := inlineElements[strings.ToLower(tagName)]
+	return ok
+}
+
+// isPreformatted returns whether whitespace inside the tagName element is
+// significant, in which case its contents are never reindented.
+func isPreformatted(tagName string) bool {
+	switch strings.ToLower(tagName) {
+	case "pre", "textarea":
+		return true
+	}
+	return false
+}
+
+type prettyState struct {
+	// Nesting depth of the element currently being written, inside mixin
+	// closures it's relative to the mixin's call site
+	depth int
+
+	// Whether a mixin closure is currently being written
+	inMixin bool
+	// Whether something may have already been written before the current node
+	wroteOutput bool
+	// Whether the current node is inside an element whose whitespace is
+	// significant
+	preformatted bool
+	// Whether the next line break must be skipped because of a whitespace
+	// trimming tag
+	skipLineBreak bool
+}
+
+// writeLineBreak starts a new line at the current nesting depth if pretty
+// printing is enabled and something may have been written before.
+func (c *context) writeLineBreak() {
+	if !c.opts.Pretty || c.pretty.preformatted {
+		return
+	}
+
+	if c.pretty.wroteOutput && !c.pretty.skipLineBreak {
+		c.w.WriteLiteralUnescaped("\n")
+		if c.pretty.inMixin {
+			c.w.WriteGoUnescaped(prettyIndentParam, "string")
+		}
+		c.w.WriteLiteralUnescaped(strings.Repeat(prettyIndent, c.pretty.depth))
+	}
+	c.pretty.wroteOutput, c.pretty.skipLineBreak = true, false
+}
+
+// mixinIndentArg returns the value passed as the prettyIndentParam of a mixin
+// called at the current depth.
+func (c *context) mixinIndentArg() string {
+	indent := strconv.Quote(strings.Repeat(prettyIndent, c.pretty.depth))
+
+	if c.pretty.inMixin {
+		if c.pretty.depth == 0 {
+			return prettyIndentParam
+		}
+		return prettyIndentParam + " + " + indent
+	}
+	return indent
+}
+
+// hasBlockContent returns whether any of the nodes would start a new line
+// when pretty printed, in which case the closing tag of their parent must be
+// written on its own line too. Statements are looked into since the nesting
+// depth doesn't depend on which branch or how many iterations are run.
+func hasBlockContent(nodes []ast.Node) bool {
+	found := false
+
+	ast.Inspect(nodes, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.NodeTag:
+			if !isInlineElement(n.Name) {
+				found = true
+			}
+
+		case *ast.NodeComment, *ast.NodeDoctype, *ast.NodeMixinCall:
+			found = true
+
+		case *ast.NodeMixinSlot:
+			// Slots are looked into like statements, so they only count as
+			// block content if their default contents do
+
+		case *ast.NodeMixinDef, *ast.NodeText:
+			// Elements inside text are written inline
+			return false
+		}
+
+		return !found
+	})
+
+	return found
+}
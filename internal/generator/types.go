@@ -0,0 +1,157 @@
+package generator
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// Types that values can be written as without going through fmt
+var (
+	intTypes  = map[string]struct{}{"int": {}, "int8": {}, "int16": {}, "int32": {}, "int64": {}, "rune": {}}
+	uintTypes = map[string]struct{}{"uint": {}, "uint8": {}, "uint16": {}, "uint32": {}, "uint64": {}, "byte": {}, "uintptr": {}}
+)
+
+func isIntType(typ string) bool {
+	_, ok := intTypes[typ]
+	return ok
+}
+
+func isUintType(typ string) bool {
+	_, ok := uintTypes[typ]
+	return ok
+}
+
+// scope holds the Go type of the variables that are visible from the code
+// being written, by name. Variables whose type isn't known are stored with an
+// empty type, so that they aren't confused with any predeclared identifier.
+type scope map[string]string
+
+// enterScope makes following declarations only last until the returned
+// function is called.
+func (c *context) enterScope() (exit func()) {
+	prev := c.vars
+	c.vars = maps.Clone(prev)
+
+	return func() { c.vars = prev }
+}
+
+// declareArgs adds the variables declared by function arguments like the ones
+// in "arg" keywords, in the form "name type".
+func (c *context) declareArgs(args []string) {
+	for _, arg := range args {
+		name, typ, _ := strings.Cut(strings.TrimSpace(arg), " ")
+		c.vars[name] = strings.TrimSpace(typ)
+	}
+}
+
+// declareStatement adds the variables declared by the Go statements in code.
+// The type of the variables declared by ranging over a slice or string of a
+// known type is inferred, any other variable is added with an unknown type.
+func (c *context) declareStatement(code string) {
+	f, err := goparser.ParseFile(token.NewFileSet(), "", "package p\nfunc _() {\n"+code+"\n}\n", 0)
+	if err != nil {
+		return
+	}
+
+	declare := func(e goast.Expr, typ string) {
+		if id, ok := e.(*goast.Ident); ok && id.Name != "_" {
+			c.vars[id.Name] = typ
+		}
+	}
+
+	goast.Inspect(f.Decls[0].(*goast.FuncDecl).Body, func(n goast.Node) bool {
+		switch n := n.(type) {
+		case *goast.FuncLit:
+			// Function literals have their own scope
+			return false
+
+		case *goast.AssignStmt:
+			if n.Tok == token.DEFINE {
+				for _, e := range n.Lhs {
+					declare(e, "")
+				}
+			}
+
+		case *goast.ValueSpec:
+			for _, id := range n.Names {
+				declare(id, "")
+			}
+
+		case *goast.RangeStmt:
+			if n.Tok == token.DEFINE {
+				key, value := c.rangeTypes(n.X)
+				if n.Key != nil {
+					declare(n.Key, key)
+				}
+				if n.Value != nil {
+					declare(n.Value, value)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// rangeTypes returns the types of the key and value of ranging over x, or
+// empty strings if they aren't known.
+func (c *context) rangeTypes(x goast.Expr) (key, value string) {
+	switch typ := c.typeOf(x); {
+	case strings.HasPrefix(typ, "[]"):
+		return "int", typ[2:]
+	case typ == "string":
+		return "int", "rune"
+	}
+
+	return "", ""
+}
+
+// exprType returns the Go type of expr if it can be known without type
+// checking the whole template, otherwise it returns an empty string.
+func (c *context) exprType(expr string) string {
+	e, err := goparser.ParseExpr(expr)
+	if err != nil {
+		return ""
+	}
+
+	return c.typeOf(e)
+}
+
+func (c *context) typeOf(e goast.Expr) string {
+	switch e := e.(type) {
+	case *goast.ParenExpr:
+		return c.typeOf(e.X)
+
+	case *goast.BasicLit:
+		switch e.Kind {
+		case token.STRING:
+			return "string"
+		case token.INT:
+			return "int"
+		case token.CHAR:
+			return "rune"
+		}
+
+	case *goast.Ident:
+		if typ, ok := c.vars[e.Name]; ok {
+			return typ
+		}
+		if e.Name == "true" || e.Name == "false" {
+			return "bool"
+		}
+
+	case *goast.CallExpr:
+		fn, ok := e.Fun.(*goast.Ident)
+		if !ok {
+			break
+		}
+		if _, shadowed := c.vars[fn.Name]; !shadowed && (fn.Name == "len" || fn.Name == "cap") {
+			return "int"
+		}
+	}
+
+	return ""
+}
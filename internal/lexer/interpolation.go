@@ -0,0 +1,173 @@
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Inline interpolations, like the ones in text and attribute values, are a
+// subset of Go expressions that can be written without parentheses:
+//
+//	Interpolation = "(" Expression ")" | Operand { Selector | Index | Call } .
+//	Operand       = identifier | int_lit | float_lit | imaginary_lit | rune_lit | string_lit .
+//	Selector      = "." identifier .
+//	Index         = "[" Expression "]" .
+//	Call          = "(" [ Expression { "," Expression } ] ")" .
+//
+// There can't be any whitespace between the parts of an interpolation, and a
+// "." that isn't followed by an identifier isn't part of it, so "@user.Name."
+// takes "user.Name". Brackets must be closed on the same line. Parenthesized
+// expressions always end the interpolation, which allows writing things like
+// "@(name).txt".
+
+// takeInterpolation takes an inline interpolation, returning false if there
+// was an error.
+func (l *Lexer) takeInterpolation() (ok bool) {
+	r, eof := l.peek()
+	if eof || r == '\n' || isWhitespace(r) {
+		l.lexUnexpected(r, "a Go expression")
+		return false
+	}
+
+	if r == '(' {
+		return l.takeBrackets()
+	}
+
+	if !l.takeOperand() {
+		return false
+	}
+
+	for {
+		r, eof := l.peek()
+		if eof {
+			return true
+		}
+
+		switch r {
+		case '.':
+			if !isIdentifierStart(l.peekSecond()) {
+				return true
+			}
+			l.take()
+
+			if !l.takeIdentifier("an identifier") {
+				return false
+			}
+
+		case '[', '(':
+			if !l.takeBrackets() {
+				return false
+			}
+
+		default:
+			return true
+		}
+	}
+}
+
+// takeOperand takes an identifier or a literal.
+func (l *Lexer) takeOperand() (ok bool) {
+	startByteIndex := l.byteIndex
+	scan, f := l.setupGoScanner()
+
+	pos, tok, lit := scan.Scan()
+	if l.err != nil {
+		return false
+	}
+
+	switch tok {
+	case token.IDENT, token.INT, token.FLOAT, token.IMAG, token.CHAR, token.STRING:
+
+	default:
+		if lit == "" {
+			lit = tok.String()
+		}
+		l.lexError(fmt.Errorf("expected an identifier or a literal, found %q", lit))
+		return false
+	}
+
+	// A number followed by a dot is more likely to be at the end of a sentence
+	if tok == token.FLOAT && strings.HasSuffix(lit, ".") {
+		lit = lit[:len(lit)-1]
+	}
+
+	l.takeUntilByteIndex(startByteIndex + int(pos) - f.Base() + len(lit))
+	return true
+}
+
+// takeBrackets takes a Go expression wrapped in brackets, up to the matching
+// closing bracket.
+func (l *Lexer) takeBrackets() (ok bool) {
+	startByteIndex := l.byteIndex
+	scan, f := l.setupGoScanner()
+
+	var open []token.Token
+
+	for {
+		pos, tok, lit := scan.Scan()
+		if l.err != nil {
+			return false
+		}
+
+		// Semicolons are inserted automatically at the end of lines
+		if tok == token.EOF || f.Line(pos) > 1 || (tok == token.SEMICOLON && lit == "\n") {
+			l.takeUntilNewline()
+			l.lexError(fmt.Errorf("unclosed %q in Go expression", open[0]))
+			return false
+		}
+
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			open = append(open, tok)
+
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			l.takeUntilByteIndex(startByteIndex + int(pos) - f.Base() + 1)
+
+			if len(open) == 0 || closingBracket(open[len(open)-1]) != tok {
+				l.lexError(fmt.Errorf("unexpected %q in Go expression", tok))
+				return false
+			}
+
+			open = open[:len(open)-1]
+			if len(open) == 0 {
+				return true
+			}
+
+		case token.SEMICOLON:
+			l.takeUntilByteIndex(startByteIndex + int(pos) - f.Base())
+			l.lexError(errors.New("unexpected ';' in Go expression"))
+			return false
+		}
+	}
+}
+
+// peekSecond returns the rune after the next one, or 0 if there is none.
+func (l *Lexer) peekSecond() rune {
+	if l.byteIndex >= len(l.file) {
+		return 0
+	}
+
+	_, size := utf8.DecodeRune(l.file[l.byteIndex:])
+	r, _ := utf8.DecodeRune(l.file[l.byteIndex+size:])
+
+	return r
+}
+
+func isIdentifierStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func closingBracket(open token.Token) token.Token {
+	switch open {
+	case token.LPAREN:
+		return token.RPAREN
+	case token.LBRACK:
+		return token.RBRACK
+	default:
+		return token.RBRACE
+	}
+}
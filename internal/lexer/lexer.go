@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"go/token"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 )
@@ -14,8 +15,8 @@ const (
 )
 
 type LexerError struct {
-	Inner    error
-	Location Location
+	Inner         error
+	Location, End Location
 }
 
 func (e *LexerError) Unwrap() error {
@@ -30,12 +31,20 @@ func (e *LexerError) At() Location {
 	return e.Location
 }
 
+func (e *LexerError) Range() Range {
+	return Range{Start: e.Location, End: e.End}
+}
+
 type UnexpectedRuneError struct {
 	Got      rune
 	Expected string
 }
 
 func (e *UnexpectedRuneError) Error() string {
+	// peek and take return a zero rune at the end of the file
+	if e.Got == 0 {
+		return fmt.Sprintf("expected %s, found end of file", e.Expected)
+	}
 	return fmt.Sprintf("expected %s, found %q", e.Expected, e.Got)
 }
 
@@ -65,7 +74,12 @@ type Lexer struct {
 	state
 	stateStack []state
 
-	err *LexerError
+	// Number of inline tags, like "#[em text]", that haven't been closed yet
+	inlineTags int
+
+	// Error found by the current state function, if any
+	err  *LexerError
+	errs []*LexerError
 }
 
 func New(file []byte, fileName string) *Lexer {
@@ -85,18 +99,29 @@ func New(file []byte, fileName string) *Lexer {
 		for state != nil {
 			state = state()
 
+			// Most states stop at the end of the file without checking
+			// whether there are inline tags left open
+			if state == nil && lexer.err == nil && lexer.inlineTags > 0 {
+				lexer.lexError(errors.New("unclosed inline tag"))
+			}
+
 			if lexer.err != nil {
-				return
+				lexer.errs = append(lexer.errs, lexer.err)
+				lexer.err = nil
+
+				state = lexer.lexRecover
 			}
 		}
 
+		eofLoc := Location{
+			File:   lexer.filename,
+			Line:   lexer.line,
+			Column: lexer.col + 1,
+		}
 		tks <- Token{
-			Type: TokenEOF,
-			Start: Location{
-				File:   lexer.filename,
-				Line:   lexer.line,
-				Column: lexer.col + 1,
-			},
+			Type:  TokenEOF,
+			Start: eofLoc,
+			End:   eofLoc,
 		}
 	}()
 
@@ -106,13 +131,26 @@ func New(file []byte, fileName string) *Lexer {
 func (l *Lexer) Next() (*Token, error) {
 	t, ok := <-l.tokens
 	if !ok {
-		return nil, l.err
+		return nil, l.firstError()
 	}
 
 	return &t, nil
 }
 
+// Collect returns all the tokens in the file, or the first error found.
 func (l *Lexer) Collect() ([]Token, error) {
+	tks, errs := l.CollectAll()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return tks, nil
+}
+
+// CollectAll returns all the tokens in the file along with every error found.
+// Lines with errors are skipped, so the tokens may be used even if there are
+// errors.
+func (l *Lexer) CollectAll() ([]Token, []*LexerError) {
 	tks := []Token{}
 
 	for t := range l.tokens {
@@ -123,11 +161,14 @@ func (l *Lexer) Collect() ([]Token, error) {
 		}
 	}
 
-	if l.err != nil {
-		return nil, l.err
-	}
+	return tks, l.errs
+}
 
-	return tks, nil
+func (l *Lexer) firstError() error {
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return l.errs[0]
 }
 
 func (l *Lexer) take() (r rune, eof bool) {
@@ -248,6 +289,7 @@ func (l *Lexer) emit(typ TokenType) {
 	l.tokens <- Token{
 		Type:     typ,
 		Start:    l.strStart,
+		End:      l.location(),
 		Contents: string(l.str),
 		Depth:    l.depth,
 	}
@@ -256,12 +298,17 @@ func (l *Lexer) emit(typ TokenType) {
 }
 
 func (l *Lexer) discard() {
-	l.strStart = Location{
+	l.strStart = l.location()
+	l.str = l.str[:0]
+}
+
+// location returns the location of the next rune to be taken.
+func (l *Lexer) location() Location {
+	return Location{
 		File:   l.filename,
 		Line:   l.line,
 		Column: l.col,
 	}
-	l.str = l.str[:0]
 }
 
 func (l *Lexer) isEmpty() bool {
@@ -272,6 +319,7 @@ func (l *Lexer) lexError(err error) stateFunc {
 	l.err = &LexerError{
 		Inner:    err,
 		Location: l.strStart,
+		End:      l.location(),
 	}
 	return nil
 }
@@ -360,6 +408,24 @@ func (l *Lexer) takeIdentifier(expected string) (found bool) {
 	}
 }
 
+// lexRecover skips the rest of the line where an error was found.
+func (l *Lexer) lexRecover() stateFunc {
+	// The error may have been found right after taking a newline
+	if l.col != 0 {
+		l.takeUntilNewline()
+	}
+	l.discard()
+
+	// Inline tags can't span several lines
+	l.inlineTags = 0
+
+	if _, eof := l.peek(); eof {
+		return nil
+	}
+
+	return l.lexNewLine
+}
+
 func (l *Lexer) lexIndentation() stateFunc {
 	l.depth = l.takeIndentation(-1)
 	l.discard()
@@ -425,7 +491,7 @@ func (l *Lexer) lexLineStart() stateFunc {
 			return l.lexInterpolationBlock(l.lexIndentation)
 		}
 
-		return l.lexInterpolationInline(l.lexForcedNewLine, true)
+		return l.lexGoStatement(l.lexForcedNewLine)
 
 	case '.': // Shortcut div with class
 		l.emit(TokenDot)
@@ -435,8 +501,12 @@ func (l *Lexer) lexLineStart() stateFunc {
 		l.emit(TokenHashtag)
 		return l.lexID
 
-	case '|': // Block text
-		l.emit(TokenPipe)
+	case '|', '\'': // Block text, apostrophes add a space after it
+		if r == '|' {
+			l.emit(TokenPipe)
+		} else {
+			l.emit(TokenApostrophe)
+		}
 
 		state := l.state
 
@@ -509,6 +579,10 @@ func (l *Lexer) lexLineStart() stateFunc {
 
 		return l.lexNewLine
 
+	case "block":
+		l.emit(TokenKeyword)
+		return l.lexBlockName
+
 	default:
 		if l.depth > 0 {
 			break
@@ -528,7 +602,7 @@ func (l *Lexer) lexLineStart() stateFunc {
 
 			return l.lexNewLine
 
-		case "import":
+		case "import", "extends":
 			l.emit(TokenKeyword)
 
 			l.takeWhitespace()
@@ -539,6 +613,10 @@ func (l *Lexer) lexLineStart() stateFunc {
 
 			return l.lexNewLine
 
+		case "use":
+			l.emit(TokenKeyword)
+			return l.lexUse
+
 		case "mixin":
 			l.emit(TokenKeyword)
 
@@ -553,6 +631,76 @@ func (l *Lexer) lexLineStart() stateFunc {
 	return l.lexAfterTag
 }
 
+func (l *Lexer) lexBlockName() stateFunc {
+	for {
+		l.takeWhitespace()
+		l.discard()
+
+		if r, eof := l.peek(); eof || r == '\n' {
+			return l.lexNewLine
+		}
+
+		if !l.takeIdentifier("block name") {
+			return nil
+		}
+		l.emit(TokenIdentifier)
+	}
+}
+
+func (l *Lexer) lexUse() stateFunc {
+	l.takeWhitespace()
+	l.discard()
+
+	// Take file path
+	for {
+		r, eof := l.peek()
+		if eof || r == '\n' || isWhitespace(r) {
+			break
+		}
+		l.take()
+	}
+	if l.isEmpty() {
+		r, _ := l.peek()
+		return l.lexUnexpected(r, "a file path")
+	}
+	l.emit(TokenImportPath)
+
+	l.takeWhitespace()
+	l.discard()
+
+	if r, eof := l.peek(); eof || r == '\n' {
+		return l.lexNewLine
+	}
+
+	// Take "as" followed by the Go package path
+	if !l.takeIdentifier(`"as"`) {
+		return nil
+	}
+	if string(l.str) != "as" {
+		return l.lexError(fmt.Errorf(`expected "as", found %q`, string(l.str)))
+	}
+	l.emit(TokenKeyword)
+
+	l.takeWhitespace()
+	l.discard()
+
+	if !l.takeRune('"') {
+		return nil
+	}
+	for {
+		r, eof := l.take()
+		if eof || r == '\n' {
+			return l.lexError(errors.New("unterminated Go package path"))
+		}
+		if r == '"' {
+			break
+		}
+	}
+	l.emit(TokenQuotedString)
+
+	return l.lexNewLine
+}
+
 func (l *Lexer) lexComment() stateFunc {
 	r, eof := l.take()
 	if eof {
@@ -595,6 +743,18 @@ func (l *Lexer) lexAfterTag() stateFunc {
 		return nil
 	}
 
+	if l.inlineTags > 0 {
+		switch r {
+		case ']':
+			l.emit(TokenBracketClose)
+			l.inlineTags--
+			return l.lexTagInlineContent
+
+		case ':', '~', '\n':
+			return l.lexUnexpected(r, "']'")
+		}
+	}
+
 	switch r {
 	case ' ':
 		l.state = state
@@ -616,6 +776,29 @@ func (l *Lexer) lexAfterTag() stateFunc {
 		l.emit(TokenColon)
 		return l.lexTextBlock
 
+	case '>': // Trim whitespace around the tag
+		l.emit(TokenGreaterThan)
+		return l.lexAfterTag
+
+	case '<': // Trim whitespace inside the tag
+		l.emit(TokenLessThan)
+		return l.lexAfterTag
+
+	case '&':
+		l.emit(TokenAmpersand)
+		return l.lexAttributesSpread
+
+	case '~': // Nest the rest of the line inside the tag
+		l.emit(TokenTilde)
+
+		l.takeWhitespace()
+		l.discard()
+
+		if r, eof := l.peek(); eof || r == '\n' {
+			return l.lexUnexpected(r, "a nested element")
+		}
+		return l.lexLineStart
+
 	default:
 		if r == '\n' {
 			l.emit(TokenNewLine)
@@ -626,6 +809,28 @@ func (l *Lexer) lexAfterTag() stateFunc {
 	return l.lexUnexpected(r, "valid tag qualifiers, content or a newline")
 }
 
+// lexAttributesSpread lexes the "attributes" keyword followed by a Go
+// expression in parentheses, after an ampersand.
+func (l *Lexer) lexAttributesSpread() stateFunc {
+	if !l.takeIdentifier(`"attributes"`) {
+		return nil
+	}
+	if string(l.str) != "attributes" {
+		return l.lexError(fmt.Errorf(`expected "attributes", found %q`, string(l.str)))
+	}
+	l.emit(TokenKeyword)
+
+	if r, eof := l.peek(); eof || r != '(' {
+		return l.lexUnexpected(r, "'('")
+	}
+	if !l.takeBrackets() {
+		return nil
+	}
+	l.emit(TokenGoExpr)
+
+	return l.lexAfterTag
+}
+
 func (l *Lexer) lexClassName() stateFunc {
 	r, eof := l.take()
 	if eof {
@@ -684,6 +889,9 @@ func (l *Lexer) lexTagInlineContent() stateFunc {
 			if !l.isEmpty() {
 				l.emit(TokenInlineText)
 			}
+			if l.inlineTags > 0 {
+				return l.lexError(errors.New("unclosed inline tag"))
+			}
 			return nil
 		}
 
@@ -708,9 +916,34 @@ func (l *Lexer) lexTagInlineContent() stateFunc {
 			}
 
 			l.emit(TokenInterpolationStart)
-			return l.lexInterpolationInline(l.lexTagInlineContent, false)
+			return l.lexInterpolationInline(l.lexTagInlineContent)
+
+		case r == '#' && l.peekSecond() == '[':
+			if !l.isEmpty() {
+				l.emit(TokenInlineText)
+			}
+
+			l.take()
+			l.take()
+			l.emit(TokenInlineTagStart)
+			l.inlineTags++
+
+			return l.lexInlineTagName
+
+		case r == ']' && l.inlineTags > 0:
+			if !l.isEmpty() {
+				l.emit(TokenInlineText)
+			}
+
+			l.take()
+			l.emit(TokenBracketClose)
+			l.inlineTags--
 
 		case r == '\n':
+			if l.inlineTags > 0 {
+				return l.lexError(errors.New("unclosed inline tag"))
+			}
+
 			if !l.isEmpty() {
 				l.emit(TokenInlineText)
 			}
@@ -722,7 +955,42 @@ func (l *Lexer) lexTagInlineContent() stateFunc {
 	}
 }
 
+// lexInlineTagName lexes the name of a tag inside inline text, after "#[".
+func (l *Lexer) lexInlineTagName() stateFunc {
+	for {
+		state := l.state
+
+		r, eof := l.take()
+		if eof {
+			return nil
+		}
+
+		if !(isASCIIDigit(r) || isASCIILetter(r) || r == '-' || r == '_') {
+			l.state = state
+
+			if l.isEmpty() {
+				return l.lexUnexpected(r, "a tag name")
+			}
+
+			break
+		}
+	}
+
+	l.emit(TokenIdentifier)
+	return l.lexAfterTag
+}
+
 func (l *Lexer) lexTextBlock() stateFunc {
+	// Optional mode that changes how lines are joined
+	if r, eof := l.peek(); !eof && (r == '-' || r == '>') {
+		l.take()
+		if r == '-' {
+			l.emit(TokenMinus)
+		} else {
+			l.emit(TokenGreaterThan)
+		}
+	}
+
 	l.depth++
 
 	minDepth := l.depth
@@ -746,8 +1014,27 @@ func (l *Lexer) lexTextBlock() stateFunc {
 }
 
 func (l *Lexer) lexAttributeName() stateFunc {
-	l.takeWhitespace()
-	l.discard()
+	// Attributes can be spread over several lines and separated by commas
+	for {
+		l.takeWhitespace()
+		l.discard()
+
+		if r, eof := l.peek(); eof || (r != '\n' && r != ',') {
+			break
+		}
+		l.take()
+	}
+
+	r, eof := l.peek()
+	if eof {
+		return nil
+	}
+	if r == '"' || r == '\'' {
+		return l.lexQuotedAttributeName
+	}
+	if !isAttributeNameStart(r) {
+		return l.lexAfterAttributes
+	}
 
 	for {
 		state := l.state
@@ -757,23 +1044,47 @@ func (l *Lexer) lexAttributeName() stateFunc {
 			return nil
 		}
 
-		if r == '\n' {
-			l.takeWhitespace()
-			l.discard()
-			continue
+		if !isAttributeNameRune(r) {
+			l.state = state
+			l.emit(TokenAttributeName)
+			return l.lexAttributeEqual
 		}
+	}
+}
 
-		if r != '-' && r != '_' && r != ':' && r != '.' && !unicode.IsLetter(r) {
-			l.state = state
+// lexQuotedAttributeName lexes an attribute name wrapped in single or double
+// quotes, which can contain characters that would otherwise end the name.
+func (l *Lexer) lexQuotedAttributeName() stateFunc {
+	quote, _ := l.take()
+	l.discard()
 
-			if l.isEmpty() {
-				return l.lexAfterAttributes
-			}
+	for {
+		state := l.state
 
-			l.emit(TokenAttributeName)
-			return l.lexAttributeEqual
+		r, eof := l.take()
+		if eof || r == '\n' {
+			l.state = state
+			return l.lexError(errors.New("unterminated attribute name"))
+		}
+		if r == quote {
+			l.state = state
+			break
+		}
+		if !isHTMLAttributeNameRune(r) {
+			return l.lexUnexpected(r, "a valid attribute name character")
 		}
 	}
+
+	if l.isEmpty() {
+		return l.lexError(errors.New("empty attribute name"))
+	}
+	l.emit(TokenAttributeName)
+
+	// Skip the closing quote
+	l.take()
+	l.discard()
+
+	return l.lexAttributeEqual
 }
 
 func (l *Lexer) lexAttributeEqual() stateFunc {
@@ -800,7 +1111,7 @@ func (l *Lexer) lexAttributeEqual() stateFunc {
 		}
 		l.emit(TokenEquals)
 
-		return l.lexInterpolationInline(l.lexAttributeName, false)
+		return l.lexInterpolationInline(l.lexAttributeName)
 
 	default:
 		return l.lexAttributeName
@@ -814,28 +1125,101 @@ func (l *Lexer) lexAttributeValue() stateFunc {
 	if eof {
 		return nil
 	}
-	if r != '"' {
+	if r != '"' && r != '\'' {
 		if isWhitespace(r) {
 			return l.lexUnexpected(r, "an attribute value")
 		}
 
 		l.state = state
-		return l.lexInterpolationInline(l.lexAttributeName, false)
+		return l.lexInterpolationInline(l.lexAttributeCondition)
 	}
 
-	for {
-		r, eof := l.take()
-		if eof {
-			return nil
-		}
-		if r == '"' {
-			break
+	// Skip the opening quote
+	l.discard()
+
+	return l.lexAttributeString(r, true)
+}
+
+// lexAttributeString lexes the rest of an attribute value wrapped in quote,
+// emitting its text and the interpolations in it. A backslash makes the
+// character after it be taken literally. If first is true nothing has been
+// emitted for the value yet, so an empty string is still emitted as text.
+func (l *Lexer) lexAttributeString(quote rune, first bool) stateFunc {
+	return func() stateFunc {
+		for {
+			r, eof := l.peek()
+			if eof {
+				return l.lexError(errors.New("unterminated attribute value"))
+			}
+
+			switch r {
+			case quote:
+				if first || !l.isEmpty() {
+					l.emit(TokenQuotedString)
+				}
+
+				// Skip the closing quote
+				l.take()
+				l.discard()
+
+				return l.lexAttributeCondition
+
+			case '\\':
+				if !l.isEmpty() {
+					l.emit(TokenQuotedString)
+					first = false
+				}
+
+				// Discard the backslash and take the character after it
+				l.take()
+				l.discard()
+				if _, eof := l.take(); eof {
+					return l.lexError(errors.New("unterminated attribute value"))
+				}
+
+			case interpolationChar:
+				if !l.isEmpty() {
+					l.emit(TokenQuotedString)
+				}
+
+				l.take()
+
+				// Two interpolation chars are written as one, like in inline text
+				if r, eof := l.peek(); !eof && r == interpolationChar {
+					l.discard()
+					l.take()
+					continue
+				}
+
+				l.emit(TokenInterpolationStart)
+				return l.lexInterpolationInline(l.lexAttributeString(quote, false))
+
+			default:
+				l.take()
+			}
 		}
 	}
+}
 
-	l.emit(TokenQuotedString)
+// lexAttributeCondition lexes the optional "?=" followed by a Go expression
+// after an attribute value.
+func (l *Lexer) lexAttributeCondition() stateFunc {
+	l.takeWhitespace()
+	l.discard()
+
+	if r, eof := l.peek(); eof || r != '?' {
+		return l.lexAttributeName
+	}
+
+	l.take()
+	l.emit(TokenQuestionMark)
+
+	if !l.takeRune('=') {
+		return nil
+	}
+	l.emit(TokenEquals)
 
-	return l.lexAttributeName
+	return l.lexInterpolationInline(l.lexAttributeName)
 }
 
 func (l *Lexer) lexAfterAttributes() stateFunc {
@@ -847,107 +1231,127 @@ func (l *Lexer) lexAfterAttributes() stateFunc {
 	return l.lexAfterTag
 }
 
-func (l *Lexer) takeGoExpression(parseStmts bool, stopOn token.Token) (gotStmt bool) {
-	if r, eof := l.peek(); !eof && r == '!' {
-		l.take()
-		l.emit(TokenExclamationPoint)
-	}
-
+// takeGoStatement lexes the Go code after an interpolation character at the
+// start of a line. Statement keywords are emitted along with the expression
+// after them, anything else is taken as a single line Go statement.
+func (l *Lexer) takeGoStatement() {
 	startByteIndex := l.byteIndex
 	scan, f := l.setupGoScanner()
 
-	var parenCount int
-	var endPos int
-	startsIdent := false
+	_, tok, lit := scan.Scan()
 
-loop:
-	for {
-		pos, tok, lit := scan.Scan()
+	switch tok {
+	// If the first token is a statement keyword, emit it and take the rest
+	// of the line as the expression after that statement
+	case token.IF, token.FOR, token.SWITCH, token.CASE:
+		l.takeUntilByteIndex(startByteIndex + len(lit))
+		l.emit(TokenKeyword)
+
+		l.takeWhitespace()
+		l.discard()
+
+		l.takeUntilNewline()
+		l.emit(TokenGoExpr)
+
+	// "else" and "default" don't take an expression, except for "else if"
+	case token.ELSE, token.DEFAULT:
+		l.takeUntilByteIndex(startByteIndex + len(lit))
+		l.emit(TokenKeyword)
 
-		if parseStmts && pos == 1 {
-			switch tok {
-			// If the first token is "if", "else" or "for", emit the corresponding start token
-			// and take the rest of the line as the expression after that statement
-			case token.IF, token.ELSE, token.FOR:
-				l.takeUntilByteIndex(startByteIndex + len(lit))
+		if tok == token.ELSE {
+			if pos, tok, _ := scan.Scan(); tok == token.IF {
+				l.takeUntilByteIndex(startByteIndex + int(pos) - f.Base())
+				l.discard()
+
+				l.takeUntilByteIndex(startByteIndex + int(pos) - f.Base() + len("if"))
 				l.emit(TokenKeyword)
 
 				l.takeWhitespace()
 				l.discard()
 
 				l.takeUntilNewline()
-				if tok == token.ELSE {
-					l.discard()
-				} else {
-					l.emit(TokenGoExpr)
-				}
+				l.emit(TokenGoExpr)
 
-				return true
+				return
 			}
 		}
 
-		switch tok {
-		case token.ILLEGAL:
-			if lit == string(interpolationChar) {
-				l.err = nil
-				break loop
-			}
+		l.takeWhitespace()
+		l.discard()
 
-		case token.IDENT:
-			if parenCount == 0 {
-				if startsIdent {
-					break loop
-				}
+		if r, eof := l.peek(); !eof && r != '\n' {
+			l.takeUntilNewline()
+			l.lexError(fmt.Errorf("unexpected %q after %q", string(l.str), lit))
+		}
 
-				startsIdent = true
-				endPos = int(pos) + len(lit)
-			}
+	// Anything else is a single line Go statement
+	default:
+		l.takeUntilNewline()
+		l.emit(TokenGoExpr)
+	}
+}
 
-		case token.LPAREN:
-			parenCount++
-		case token.RPAREN:
-			parenCount--
+// takeGoArgument takes a Go expression up to a comma or a closing parenthesis
+// that isn't inside brackets.
+func (l *Lexer) takeGoArgument() (ok bool) {
+	startByteIndex := l.byteIndex
+	scan, f := l.setupGoScanner()
 
-			if parenCount < 0 {
-				endPos = int(pos)
-				break loop
-			}
-			if parenCount == 0 {
-				endPos = int(pos) + 1
-				break loop
-			}
+	depth := 0
+	end := 0
 
-		case stopOn:
-			if parenCount == 0 {
-				endPos = int(pos)
-				break loop
-			}
+	for {
+		pos, tok, lit := scan.Scan()
+		if l.err != nil {
+			return false
+		}
 
-		case token.EOF:
-			if parenCount != 0 {
-				l.lexError(errors.New("unfinished Go expression"))
-				return
-			}
-			break loop
+		if tok == token.EOF || f.Line(pos) > 1 || (tok == token.SEMICOLON && lit == "\n") {
+			l.takeUntilNewline()
+			l.lexError(errors.New("unfinished Go expression"))
+			return false
 		}
-	}
 
-	endIndex := int(endPos) - f.Base()
+		switch tok {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
 
-	for l.byteIndex < startByteIndex+endIndex {
-		l.take()
+		case token.RPAREN, token.RBRACK, token.RBRACE, token.COMMA:
+			if depth == 0 && (tok == token.RPAREN || tok == token.COMMA) {
+				l.takeUntilByteIndex(startByteIndex + end)
+				return true
+			}
+			if tok != token.COMMA {
+				depth--
+			}
+		}
+
+		if lit == "" {
+			lit = tok.String()
+		}
+		end = int(pos) - f.Base() + len(lit)
 	}
+}
 
-	return false
+func (l *Lexer) lexGoStatement(returnTo stateFunc) stateFunc {
+	return func() stateFunc {
+		l.takeGoStatement()
+		return returnTo
+	}
 }
 
-func (l *Lexer) lexInterpolationInline(returnTo stateFunc, parseStmts bool) stateFunc {
+func (l *Lexer) lexInterpolationInline(returnTo stateFunc) stateFunc {
 	return func() stateFunc {
-		gotStmt := l.takeGoExpression(parseStmts, 0)
-		if !gotStmt {
-			l.emit(TokenGoExpr)
+		if r, eof := l.peek(); !eof && r == '!' {
+			l.take()
+			l.emit(TokenExclamationPoint)
 		}
 
+		if !l.takeInterpolation() {
+			return nil
+		}
+		l.emit(TokenGoExpr)
+
 		return returnTo
 	}
 }
@@ -1008,10 +1412,17 @@ func (l *Lexer) lexMixinDef() stateFunc {
 
 	// Lex mixin args
 loop:
-	for {
+	for i := 0; ; i++ {
 		l.takeWhitespace()
 		l.discard()
 
+		// The argument list may be empty
+		if r, eof := l.peek(); i == 0 && !eof && r == ')' {
+			l.take()
+			l.emit(TokenParenClose)
+			break
+		}
+
 		// Take argument name
 		if !l.takeIdentifier("mixin argument name") {
 			return nil
@@ -1091,16 +1502,28 @@ func (l *Lexer) lexMixinCall() stateFunc {
 	l.takeWhitespace()
 	l.discard()
 
+	if r, eof := l.peek(); !eof && r == ')' {
+		l.take()
+		l.emit(TokenParenClose)
+		return l.lexMixinCallAttributes
+	}
+
 loop:
 	for {
-		l.takeGoExpression(false, token.COMMA)
+		if !l.takeGoArgument() {
+			return nil
+		}
 
 		if l.isEmpty() {
-			break
+			r, _ := l.peek()
+			return l.lexUnexpected(r, "an argument value")
 		}
 
 		l.emit(TokenGoExpr)
 
+		l.takeWhitespace()
+		l.discard()
+
 		r, eof := l.take()
 		if eof {
 			return nil
@@ -1122,6 +1545,18 @@ loop:
 		}
 	}
 
+	return l.lexMixinCallAttributes
+}
+
+// lexMixinCallAttributes lexes the optional attribute list after the
+// arguments of a mixin call.
+func (l *Lexer) lexMixinCallAttributes() stateFunc {
+	if r, eof := l.peek(); !eof && r == '(' {
+		l.take()
+		l.emit(TokenParenOpen)
+		return l.lexAttributeName
+	}
+
 	return l.lexForcedNewLine
 }
 
@@ -1133,6 +1568,24 @@ func isASCIIDigit(r rune) bool {
 	return r >= '0' && r <= '9'
 }
 
+// isAttributeNameStart returns whether an unquoted attribute name can start
+// with r. Names with other characters must be quoted.
+func isAttributeNameStart(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_:.@[", r)
+}
+
+// isAttributeNameRune returns whether r can be part of an unquoted attribute
+// name, like "x1", "@click", "x-on:click.prevent" or "[prop]".
+func isAttributeNameRune(r rune) bool {
+	return isAttributeNameStart(r) || r == ']'
+}
+
+// isHTMLAttributeNameRune returns whether r can be part of an HTML attribute
+// name, which is what quoted attribute names can contain.
+func isHTMLAttributeNameRune(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsControl(r) && !strings.ContainsRune(`"'>/=`, r)
+}
+
 func isWhitespace(r rune) bool {
 	return r == ' ' || r == '\t'
 }
@@ -0,0 +1,459 @@
+package lexer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type lexerTest struct {
+	name string
+	src  string
+
+	// Tokens as formatted by tokenString, without the final EOF. Not checked
+	// if nil and err is set.
+	want []string
+	// First error, including its location
+	err string
+}
+
+func runLexerTests(t *testing.T, tests []lexerTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tks, errs := New([]byte(tt.src), "test.poo").CollectAll()
+
+			var got []string
+			for _, tk := range tks {
+				if tk.Type != TokenEOF {
+					got = append(got, tokenString(tk))
+				}
+			}
+
+			if tt.err == "" && len(errs) > 0 {
+				t.Fatalf("unexpected error: %s", errs[0])
+			}
+			if tt.err != "" {
+				if len(errs) == 0 {
+					t.Fatalf("got no errors, want %q\ntokens: %s", tt.err, strings.Join(got, " "))
+				}
+				if errs[0].Error() != tt.err {
+					t.Errorf("got error %q, want %q", errs[0], tt.err)
+				}
+				if tt.want == nil {
+					return
+				}
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got tokens:\n\t%s\nwant:\n\t%s", strings.Join(got, " "), strings.Join(tt.want, " "))
+			}
+		})
+	}
+}
+
+func tokenString(tk Token) string {
+	return fmt.Sprintf("%s(%q)", tk.Type, tk.Contents)
+}
+
+func TestLexStatements(t *testing.T) {
+	runLexerTests(t, []lexerTest{
+		{
+			name: "ElseIf",
+			src:  "@if x\n  p a\n@else if y > 1\n  p b\n@else\n  p c\n",
+			want: []string{
+				`Interpolation start("@")`, `Keyword("if")`, `Go expression("x")`, `Newline("\n")`,
+				`Identifier("p")`, `Inline text("a")`, `Newline("\n")`,
+				`Interpolation start("@")`, `Keyword("else")`, `Keyword("if")`, `Go expression("y > 1")`, `Newline("\n")`,
+				`Identifier("p")`, `Inline text("b")`, `Newline("\n")`,
+				`Interpolation start("@")`, `Keyword("else")`, `Newline("\n")`,
+				`Identifier("p")`, `Inline text("c")`,
+			},
+		},
+		{
+			name: "Switch",
+			src:  "@switch v\n  @case 1, 2\n    p x\n  @default\n    p y\n",
+			want: []string{
+				`Interpolation start("@")`, `Keyword("switch")`, `Go expression("v")`, `Newline("\n")`,
+				`Interpolation start("@")`, `Keyword("case")`, `Go expression("1, 2")`, `Newline("\n")`,
+				`Identifier("p")`, `Inline text("x")`, `Newline("\n")`,
+				`Interpolation start("@")`, `Keyword("default")`, `Newline("\n")`,
+				`Identifier("p")`, `Inline text("y")`,
+			},
+		},
+		{
+			name: "ElseWithText",
+			src:  "@else foo\n",
+			err:  `unexpected "foo" after "else" at test.poo:1:7`,
+		},
+		{
+			name: "DefaultWithExpression",
+			src:  "@default x\n",
+			err:  `unexpected "x" after "default" at test.poo:1:10`,
+		},
+	})
+}
+
+func TestLexInterpolation(t *testing.T) {
+	runLexerTests(t, []lexerTest{
+		{
+			name: "Selector",
+			src:  "p Hi @user.Name!",
+			want: []string{`Identifier("p")`, `Inline text("Hi ")`, `Interpolation start("@")`, `Go expression("user.Name")`, `Inline text("!")`},
+		},
+		{
+			name: "IndexAndSelector",
+			src:  "p @items[0].Title, ok",
+			want: []string{`Identifier("p")`, `Interpolation start("@")`, `Go expression("items[0].Title")`, `Inline text(", ok")`},
+		},
+		{
+			name: "CallBeforeDot",
+			src:  `p @user.Format("x", 1).`,
+			want: []string{`Identifier("p")`, `Interpolation start("@")`, `Go expression("user.Format(\"x\", 1)")`, `Inline text(".")`},
+		},
+		{
+			name: "DotWithoutIdentifier",
+			src:  "p @x.1",
+			want: []string{`Identifier("p")`, `Interpolation start("@")`, `Go expression("x")`, `Inline text(".1")`},
+		},
+		{
+			name: "StopsAtOperator",
+			src:  "p total: @price*2",
+			want: []string{`Identifier("p")`, `Inline text("total: ")`, `Interpolation start("@")`, `Go expression("price")`, `Inline text("*2")`},
+		},
+		{
+			name: "Literals",
+			src:  `p @"lit" @42 @'a'b`,
+			want: []string{
+				`Identifier("p")`, `Interpolation start("@")`, `Go expression("\"lit\"")`, `Inline text(" ")`,
+				`Interpolation start("@")`, `Go expression("42")`, `Inline text(" ")`,
+				`Interpolation start("@")`, `Go expression("'a'")`, `Inline text("b")`,
+			},
+		},
+		{
+			name: "ParenthesizedAndUnescaped",
+			src:  "p @(a + b).txt @!raw",
+			want: []string{
+				`Identifier("p")`, `Interpolation start("@")`, `Go expression("(a + b)")`, `Inline text(".txt ")`,
+				`Interpolation start("@")`, `Exclamation point("!")`, `Go expression("raw")`,
+			},
+		},
+		{
+			name: "EscapedAt",
+			src:  "p @@ at",
+			want: []string{`Identifier("p")`, `Inline text("@ at")`},
+		},
+		{
+			name: "UnclosedParenthesis",
+			src:  "p @(a + b",
+			err:  `unclosed "(" in Go expression at test.poo:1:4`,
+		},
+		{
+			name: "UnclosedCall",
+			src:  "p @f(1, 2",
+			err:  `unclosed "(" in Go expression at test.poo:1:4`,
+		},
+		{
+			name: "IndexClosedOnNextLine",
+			src:  "p @a[0\n]",
+			err:  `unclosed "[" in Go expression at test.poo:1:4`,
+		},
+		{
+			name: "WhitespaceAfterAt",
+			src:  "p @ x",
+			err:  `expected a Go expression, found ' ' at test.poo:1:4`,
+		},
+		{
+			name: "AtEndOfLine",
+			src:  "p a @\n",
+			err:  `expected a Go expression, found '\n' at test.poo:1:6`,
+		},
+		{
+			name: "AtEndOfFile",
+			src:  "p a @",
+			err:  `expected a Go expression, found end of file at test.poo:1:6`,
+		},
+	})
+}
+
+func TestLexAttributeNames(t *testing.T) {
+	runLexerTests(t, []lexerTest{
+		{
+			name: "CommaSeparators",
+			src:  `a(href="x", title="y",disabled)`,
+			want: []string{
+				`Identifier("a")`, `Parentheses open("(")`,
+				`Attribute name("href")`, `Equals("=")`, `Quoted string("x")`,
+				`Attribute name("title")`, `Equals("=")`, `Quoted string("y")`,
+				`Attribute name("disabled")`, `Parentheses close(")")`,
+			},
+		},
+		{
+			name: "LeadingComma",
+			src:  "p(,a)",
+			want: []string{`Identifier("p")`, `Parentheses open("(")`, `Attribute name("a")`, `Parentheses close(")")`},
+		},
+		{
+			name: "FrameworkNames",
+			src:  `div(@click="go" :class="c" x.y [b]=1 data-1)`,
+			want: []string{
+				`Identifier("div")`, `Parentheses open("(")`,
+				`Attribute name("@click")`, `Equals("=")`, `Quoted string("go")`,
+				`Attribute name(":class")`, `Equals("=")`, `Quoted string("c")`,
+				`Attribute name("x.y")`,
+				`Attribute name("[b]")`, `Equals("=")`, `Go expression("1")`,
+				`Attribute name("data-1")`, `Parentheses close(")")`,
+			},
+		},
+		{
+			name: "MultipleLines",
+			src:  "p(a=\"x\"\n  b=\"y\")",
+			want: []string{
+				`Identifier("p")`, `Parentheses open("(")`,
+				`Attribute name("a")`, `Equals("=")`, `Quoted string("x")`,
+				`Attribute name("b")`, `Equals("=")`, `Quoted string("y")`,
+				`Parentheses close(")")`,
+			},
+		},
+		{
+			name: "QuotedNames",
+			src:  `p("x+y"="v" '(a),b')`,
+			want: []string{
+				`Identifier("p")`, `Parentheses open("(")`,
+				`Attribute name("x+y")`, `Equals("=")`, `Quoted string("v")`,
+				`Attribute name("(a),b")`, `Parentheses close(")")`,
+			},
+		},
+		{
+			name: "OperatorInValue",
+			src:  "p(data-x=n+1)",
+			err:  `expected ')', found '+' at test.poo:1:11`,
+		},
+		{
+			name: "OperatorStartingName",
+			src:  "p(+a)",
+			err:  `expected ')', found '+' at test.poo:1:3`,
+		},
+		{
+			name: "BracketStartingName",
+			src:  "p(]x)",
+			err:  `expected ')', found ']' at test.poo:1:3`,
+		},
+		{
+			name: "UnclosedList",
+			src:  "p(a=\"x\" ]\np ok",
+			err:  `expected ')', found ']' at test.poo:1:9`,
+		},
+		{
+			name: "InvalidQuotedName",
+			src:  `p("a=b"="v")`,
+			err:  `expected a valid attribute name character, found '=' at test.poo:1:4`,
+		},
+		{
+			name: "UnbalancedQuoteInName",
+			src:  "p(\"x)\np ok",
+			want: []string{`Identifier("p")`, `Parentheses open("(")`, `Newline("\n")`, `Identifier("p")`, `Inline text("ok")`},
+			err:  `unterminated attribute name at test.poo:1:4`,
+		},
+		{
+			name: "UnbalancedQuoteInNameAtEOF",
+			src:  `p('x`,
+			err:  `unterminated attribute name at test.poo:1:4`,
+		},
+	})
+}
+
+func TestLexAttributeValues(t *testing.T) {
+	runLexerTests(t, []lexerTest{
+		{
+			name: "Interpolation",
+			src:  `a(title="Hi @name!" href='/u/@(id)')`,
+			want: []string{
+				`Identifier("a")`, `Parentheses open("(")`,
+				`Attribute name("title")`, `Equals("=")`,
+				`Quoted string("Hi ")`, `Interpolation start("@")`, `Go expression("name")`, `Quoted string("!")`,
+				`Attribute name("href")`, `Equals("=")`,
+				`Quoted string("/u/")`, `Interpolation start("@")`, `Go expression("(id)")`,
+				`Parentheses close(")")`,
+			},
+		},
+		{
+			name: "Escapes",
+			src:  `p(a="say \"hi\" @@home" b='it\'s')`,
+			want: []string{
+				`Identifier("p")`, `Parentheses open("(")`,
+				`Attribute name("a")`, `Equals("=")`,
+				`Quoted string("say ")`, `Quoted string("\"hi")`, `Quoted string("\" ")`, `Quoted string("@home")`,
+				`Attribute name("b")`, `Equals("=")`,
+				`Quoted string("it")`, `Quoted string("'s")`,
+				`Parentheses close(")")`,
+			},
+		},
+		{
+			name: "Empty",
+			src:  `p(a='')`,
+			want: []string{`Identifier("p")`, `Parentheses open("(")`, `Attribute name("a")`, `Equals("=")`, `Quoted string("")`, `Parentheses close(")")`},
+		},
+		{
+			name: "UnbalancedQuote",
+			src:  "p(a=\"x)\np ok",
+			err:  `unterminated attribute value at test.poo:1:6`,
+		},
+		{
+			name: "UnbalancedSingleQuote",
+			src:  "p(a='x\n",
+			err:  `unterminated attribute value at test.poo:1:6`,
+		},
+		{
+			name: "BackslashAtEnd",
+			src:  `p(a="x\`,
+			err:  `unterminated attribute value at test.poo:1:8`,
+		},
+		{
+			name: "AtWithoutExpression",
+			src:  `p(a="x @ y")`,
+			err:  `expected a Go expression, found ' ' at test.poo:1:9`,
+		},
+	})
+}
+
+func TestLexInlineTags(t *testing.T) {
+	runLexerTests(t, []lexerTest{
+		{
+			name: "WithAttributes",
+			src:  `p Go to #[a(href="/") home] now`,
+			want: []string{
+				`Identifier("p")`, `Inline text("Go to ")`,
+				`Inline tag start("#[")`, `Identifier("a")`,
+				`Parentheses open("(")`, `Attribute name("href")`, `Equals("=")`, `Quoted string("/")`, `Parentheses close(")")`,
+				`Inline text("home")`, `Bracket close("]")`,
+				`Inline text(" now")`,
+			},
+		},
+		{
+			name: "Nested",
+			src:  "p #[b #[i x]] y",
+			want: []string{
+				`Identifier("p")`,
+				`Inline tag start("#[")`, `Identifier("b")`,
+				`Inline tag start("#[")`, `Identifier("i")`, `Inline text("x")`, `Bracket close("]")`,
+				`Bracket close("]")`, `Inline text(" y")`,
+			},
+		},
+		{
+			name: "QualifiersAndInterpolation",
+			src:  "p #[span.c#d hi @name]",
+			want: []string{
+				`Identifier("p")`,
+				`Inline tag start("#[")`, `Identifier("span")`, `Dot(".")`, `Class name("c")`, `Hashtag("#")`, `ID("d")`,
+				`Inline text("hi ")`, `Interpolation start("@")`, `Go expression("name")`, `Bracket close("]")`,
+			},
+		},
+		{
+			name: "InPipedText",
+			src:  "| see #[em this]",
+			want: []string{`Pipe("|")`, `Inline text("see ")`, `Inline tag start("#[")`, `Identifier("em")`, `Inline text("this")`, `Bracket close("]")`},
+		},
+		{
+			name: "BracketOutsideTag",
+			src:  "p a ] b",
+			want: []string{`Identifier("p")`, `Inline text("a ] b")`},
+		},
+		{
+			name: "UnterminatedAtEndOfLine",
+			src:  "p a #[b x\np ok",
+			want: []string{`Identifier("p")`, `Inline text("a ")`, `Inline tag start("#[")`, `Identifier("b")`, `Newline("\n")`, `Identifier("p")`, `Inline text("ok")`},
+			err:  `unclosed inline tag at test.poo:1:9`,
+		},
+		{
+			name: "UnterminatedAtEOF",
+			src:  "p a #[b x",
+			err:  `unclosed inline tag at test.poo:1:10`,
+		},
+		{
+			name: "UnterminatedAfterStart",
+			src:  "p #[",
+			err:  `unclosed inline tag at test.poo:1:5`,
+		},
+		{
+			name: "UnterminatedAfterName",
+			src:  "p #[b",
+			err:  `unclosed inline tag at test.poo:1:5`,
+		},
+		{
+			name: "UnterminatedAfterAttributes",
+			src:  `p #[b(x="1")`,
+			err:  `unclosed inline tag at test.poo:1:13`,
+		},
+		{
+			name: "Empty",
+			src:  "p #[]",
+			err:  `expected a tag name, found ']' at test.poo:1:5`,
+		},
+		{
+			name: "Tilde",
+			src:  "p a #[b~ c]",
+			err:  `expected ']', found '~' at test.poo:1:8`,
+		},
+		{
+			name: "Colon",
+			src:  "p a #[b: c]",
+			err:  `expected ']', found ':' at test.poo:1:8`,
+		},
+	})
+}
+
+func TestLexBlockExpansion(t *testing.T) {
+	runLexerTests(t, []lexerTest{
+		{
+			name: "Element",
+			src:  "li~ a x\n",
+			want: []string{`Identifier("li")`, `Tilde("~")`, `Identifier("a")`, `Inline text("x")`},
+		},
+		{
+			name: "Chained",
+			src:  "li~ p~ span y\n",
+			want: []string{`Identifier("li")`, `Tilde("~")`, `Identifier("p")`, `Tilde("~")`, `Identifier("span")`, `Inline text("y")`},
+		},
+		{
+			name: "AfterQualifiers",
+			src:  "li.c(x=\"1\")~ b\n",
+			want: []string{
+				`Identifier("li")`, `Dot(".")`, `Class name("c")`,
+				`Parentheses open("(")`, `Attribute name("x")`, `Equals("=")`, `Quoted string("1")`, `Parentheses close(")")`,
+				`Tilde("~")`, `Identifier("b")`, `Newline("\n")`,
+			},
+		},
+		{
+			name: "WithChildren",
+			src:  "li~ a x\n  span more\n",
+			want: []string{
+				`Identifier("li")`, `Tilde("~")`, `Identifier("a")`, `Inline text("x")`, `Newline("\n")`,
+				`Identifier("span")`, `Inline text("more")`,
+			},
+		},
+		{
+			name: "AfterSpaceIsText",
+			src:  "li ~ a x\n",
+			want: []string{`Identifier("li")`, `Inline text("~ a x")`},
+		},
+		{
+			name: "AtEndOfLine",
+			src:  "li~\np x",
+			want: []string{`Identifier("li")`, `Tilde("~")`, `Newline("\n")`, `Identifier("p")`, `Inline text("x")`},
+			err:  `expected a nested element, found '\n' at test.poo:1:4`,
+		},
+		{
+			name: "WhitespaceAtEndOfLine",
+			src:  "li~ \n",
+			err:  `expected a nested element, found '\n' at test.poo:1:5`,
+		},
+		{
+			name: "AtEndOfFile",
+			src:  "li~",
+			err:  `expected a nested element, found end of file at test.poo:1:4`,
+		},
+	})
+}
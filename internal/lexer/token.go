@@ -23,6 +23,14 @@ const (
 	TokenQuestionMark
 	TokenExclamationPoint
 	TokenPipe
+	TokenApostrophe
+	TokenGreaterThan
+	TokenLessThan
+	TokenMinus
+	TokenAmpersand
+	TokenInlineTagStart
+	TokenBracketClose
+	TokenTilde
 
 	TokenCommentStart
 	TokenCommentStartBuffered
@@ -77,6 +85,22 @@ func (t TokenType) String() string {
 		return "Exclamation point"
 	case TokenPipe:
 		return "Pipe"
+	case TokenApostrophe:
+		return "Apostrophe"
+	case TokenGreaterThan:
+		return "Greater than"
+	case TokenLessThan:
+		return "Less than"
+	case TokenMinus:
+		return "Minus"
+	case TokenAmpersand:
+		return "Ampersand"
+	case TokenInlineTagStart:
+		return "Inline tag start"
+	case TokenBracketClose:
+		return "Bracket close"
+	case TokenTilde:
+		return "Tilde"
 
 	case TokenCommentStart:
 		return "Comment start"
@@ -110,10 +134,14 @@ func (t TokenType) String() string {
 }
 
 type Token struct {
-	Type     TokenType
-	Start    Location
-	Depth    int
-	Contents string
+	Type       TokenType
+	Start, End Location
+	Depth      int
+	Contents   string
+}
+
+func (t *Token) Range() Range {
+	return Range{Start: t.Start, End: t.End}
 }
 
 type Location struct {
@@ -126,3 +154,8 @@ type Location struct {
 func (l *Location) String() string {
 	return fmt.Sprintf("%s:%d:%d", l.File, l.Line+1, l.Column+1)
 }
+
+// Range is a span of source code, End is the location right after the last character.
+type Range struct {
+	Start, End Location
+}
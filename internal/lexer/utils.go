@@ -21,13 +21,18 @@ func (l *Lexer) setupGoScanner() (*scanner.Scanner, *token.File) {
 			col += l.col
 		}
 
+		loc := Location{
+			File:   l.filename,
+			Line:   l.line + pos.Line - 1,
+			Column: col,
+		}
+		end := loc
+		end.Column++
+
 		l.err = &LexerError{
-			Inner: fmt.Errorf("scan Go code: %s", msg),
-			Location: Location{
-				File:   l.filename,
-				Line:   l.line + pos.Line - 1,
-				Column: col,
-			},
+			Inner:    fmt.Errorf("scan Go code: %s", msg),
+			Location: loc,
+			End:      end,
 		}
 	}, 0)
 
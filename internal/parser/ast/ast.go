@@ -1,13 +1,24 @@
 package ast
 
 import (
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
 	"github.com/pipe01/poodle/internal/lexer"
 )
 
-type Pos lexer.Location
+// Pos is the span of source code a node was parsed from.
+type Pos lexer.Range
 
 func (p Pos) Position() lexer.Location {
-	return lexer.Location(p)
+	return p.Start
+}
+
+func (p Pos) Range() lexer.Range {
+	return lexer.Range(p)
 }
 
 type File struct {
@@ -16,10 +27,14 @@ type File struct {
 
 	Args    []string
 	Imports []string
+
+	// Template this file extends, its blocks are overridden by the ones in Nodes
+	Extends *File
 }
 
 type Node interface {
 	Position() lexer.Location
+	Range() lexer.Range
 }
 
 type NodeComment struct {
@@ -54,19 +69,98 @@ type NodeInclude struct {
 	Path string
 }
 
+// NodeUse makes the mixins defined in File available to the current file.
+type NodeUse struct {
+	Pos
+
+	File *File
+	Path string
+
+	// Import path of the Go package that File was compiled into as a
+	// library, empty if its mixins should be compiled into this file
+	GoPackage string
+}
+
+// GoPackageName returns the name that GoPackage is imported as. It's the last
+// element of the import path, or the one before it if the last one is a major
+// version suffix like "v2", with any characters that can't be part of a Go
+// identifier replaced by underscores.
+func (n *NodeUse) GoPackageName() string {
+	name := path.Base(n.GoPackage)
+	if v, ok := strings.CutPrefix(name, "v"); ok && path.Dir(n.GoPackage) != "." {
+		if _, err := strconv.Atoi(v); err == nil {
+			name = path.Base(path.Dir(n.GoPackage))
+		}
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+
+	// Names can't start with a digit or be a keyword
+	if !token.IsIdentifier(name) || name == "_" {
+		name = "pkg_" + name
+	}
+
+	return name
+}
+
+type BlockMode int
+
+const (
+	BlockReplace BlockMode = iota
+	BlockAppend
+	BlockPrepend
+)
+
+type NodeBlock struct {
+	Pos
+
+	Name  string
+	Mode  BlockMode
+	Nodes []Node
+}
+
 type NodeMixinCall struct {
 	Pos
 
 	Name string
 	Args []string
+
+	// Attributes given after the arguments, the mixin can read them from its
+	// "attributes" variable
+	Attributes []TagAttribute
+
+	// Contents of the mixin's blocks, named blocks are specified as
+	// NodeBlock nodes and the rest of the nodes form the unnamed block
+	Nodes []Node
+}
+
+// NodeMixinSlot is a block inside a mixin definition where the contents passed
+// in the mixin call are placed.
+type NodeMixinSlot struct {
+	Pos
+
+	// Empty for the unnamed block
+	Name string
+
+	// Default contents, used if the mixin call doesn't specify any
+	Nodes []Node
 }
 
 type StatementKeyword string
 
 const (
-	KeywordIf   StatementKeyword = "if"
-	KeywordElse StatementKeyword = "else"
-	KeywordFor  StatementKeyword = "for"
+	KeywordIf      StatementKeyword = "if"
+	KeywordElse    StatementKeyword = "else"
+	KeywordElseIf  StatementKeyword = "else if"
+	KeywordFor     StatementKeyword = "for"
+	KeywordSwitch  StatementKeyword = "switch"
+	KeywordCase    StatementKeyword = "case"
+	KeywordDefault StatementKeyword = "default"
 )
 
 type NodeGoStatement struct {
@@ -76,7 +170,18 @@ type NodeGoStatement struct {
 	Nodes   []Node
 
 	Argument string
-	HasElse  bool
+
+	// True if the statement is an "if" or "else if" that is followed by an
+	// "else" or "else if"
+	HasElse bool
+}
+
+// NodeGoLine is a line of Go code outside of a block, such as an assignment
+// or a function call.
+type NodeGoLine struct {
+	Pos
+
+	Contents string
 }
 
 type NodeGoBlock struct {
@@ -98,13 +203,26 @@ type NodeTag struct {
 	Attributes []TagAttribute
 	Nodes      []Node
 
+	// Go expression whose attributes are added to the element at runtime,
+	// from "&attributes(expr)". They override the ones in Attributes, except
+	// for class and style which are merged.
+	SpreadAttributes string
+
 	IsSelfClosing bool
+
+	// Remove the whitespace around the element, or at the start and end of
+	// its contents
+	TrimOuter, TrimInner bool
 }
 
 type TagAttribute struct {
 	Pos
 
-	Name  string
+	Name string
+
+	// Value of the attribute, if it's nil only the name is written. If it's a
+	// single Go expression the attribute is left out when its value is false,
+	// nil or an empty string, and only the name is written when it's true.
 	Value Value
 
 	// Only add this attribute if this Go expression evaluates to true
@@ -125,8 +243,10 @@ func (ValueLiteral) value() {}
 
 type ValueGoExpr struct {
 	Pos
-	Contents   string
-	EscapeHTML bool
+	Contents string
+
+	// False if the value was marked with "!" to be written as is
+	Escape bool
 }
 
 func (ValueGoExpr) value() {}
@@ -137,3 +257,52 @@ type ValueConcat struct {
 }
 
 func (ValueConcat) value() {}
+
+// ValueTag is an element written in the middle of inline text, like
+// "#[em text]".
+type ValueTag struct {
+	Pos
+	Tag *NodeTag
+}
+
+func (ValueTag) value() {}
+
+// inlineTags returns the elements inside of v.
+func inlineTags(v Value) []Node {
+	switch v := v.(type) {
+	case ValueTag:
+		return []Node{v.Tag}
+	case ValueConcat:
+		return append(inlineTags(v.A), inlineTags(v.B)...)
+	}
+	return nil
+}
+
+// Inspect traverses nodes in depth-first order, calling f for each node. If f
+// returns false, the children of that node aren't visited.
+func Inspect(nodes []Node, f func(Node) bool) {
+	for _, n := range nodes {
+		if !f(n) {
+			continue
+		}
+
+		switch n := n.(type) {
+		case *NodeTag:
+			Inspect(n.Nodes, f)
+		case *NodeGoStatement:
+			Inspect(n.Nodes, f)
+		case *NodeBlock:
+			Inspect(n.Nodes, f)
+		case *NodeMixinDef:
+			Inspect(n.Nodes, f)
+		case *NodeMixinSlot:
+			Inspect(n.Nodes, f)
+		case *NodeMixinCall:
+			Inspect(n.Nodes, f)
+		case *NodeInclude:
+			Inspect(n.File.Nodes, f)
+		case *NodeText:
+			Inspect(inlineTags(n.Text), f)
+		}
+	}
+}
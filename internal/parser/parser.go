@@ -3,6 +3,9 @@ package parser
 import (
 	"errors"
 	"fmt"
+	goparser "go/parser"
+	"go/scanner"
+	"go/token"
 	"path/filepath"
 	"strings"
 
@@ -14,8 +17,8 @@ import (
 var ErrLastTokenEOF = errors.New("last token must be EOF")
 
 type ParserError struct {
-	Inner    error
-	Location lexer.Location
+	Inner         error
+	Location, End lexer.Location
 }
 
 func (e *ParserError) Unwrap() error {
@@ -30,6 +33,10 @@ func (e *ParserError) At() lexer.Location {
 	return e.Location
 }
 
+func (e *ParserError) Range() lexer.Range {
+	return lexer.Range{Start: e.Location, End: e.End}
+}
+
 type UnexpectedTokenError struct {
 	Got      *lexer.Token
 	Expected string
@@ -64,24 +71,48 @@ type parser struct {
 	errs    []*ParserError
 	imports []string
 	args    []string
+	extends *File
+
+	// Whether a mixin definition is being parsed
+	inMixinDef bool
+	// Depth of the direct children of the innermost mixin call being parsed, or -1
+	mixinCallDepth int
+	// Whether the direct children of a switch statement are being parsed
+	inSwitch bool
 }
 
+// Parse parses a file from its tokens, returning the first error found.
 func Parse(tokens []lexer.Token, loadFile func(string) (*File, error)) (*File, error) {
+	f, errs := ParseAll(tokens, loadFile)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return f, nil
+}
+
+// ParseAll parses a file from its tokens like Parse, but instead of stopping at
+// the first error it skips the offending line and keeps going. It returns every
+// error found along with the partially parsed file.
+func ParseAll(tokens []lexer.Token, loadFile func(string) (*File, error)) (*File, []error) {
 	p := parser{
-		tokens:   tokens,
-		loadFile: loadFile,
+		tokens:         tokens,
+		loadFile:       loadFile,
+		mixinCallDepth: -1,
 	}
 
-	if tokens[len(tokens)-1].Type != lexer.TokenEOF {
-		return nil, ErrLastTokenEOF
+	if len(tokens) == 0 || tokens[len(tokens)-1].Type != lexer.TokenEOF {
+		return nil, []error{ErrLastTokenEOF}
 	}
 
 	f := p.parseFile()
-	if len(p.errs) > 0 {
-		return nil, p.errs[0]
+
+	errs := make([]error, len(p.errs))
+	for i, e := range p.errs {
+		errs[i] = e
 	}
 
-	return f, nil
+	return f, errs
 }
 
 func (p *parser) take() (tk *lexer.Token) {
@@ -101,7 +132,12 @@ func (p *parser) mustTake(typ lexer.TokenType) (tk *lexer.Token, found bool) {
 		p.addErrorAt(&UnexpectedTokenError{
 			Got:      tk,
 			Expected: typ.String(),
-		}, tk.Start)
+		}, tk.Range())
+
+		// Leave line ends for the caller, so it can recover from the error
+		if tk.Type == lexer.TokenNewLine {
+			p.rewind()
+		}
 		return nil, false
 	}
 
@@ -124,14 +160,41 @@ func (p *parser) peek() *lexer.Token {
 	return &p.tokens[p.index]
 }
 
+// isLineStart returns whether the last token taken ended a line.
+func (p *parser) isLineStart() bool {
+	return p.index == 0 || p.tokens[p.index-1].Type == lexer.TokenNewLine
+}
+
+// skipLines discards tokens until the start of the next line that isn't
+// indented deeper than depth, this way the children of a node with errors
+// are skipped as well.
+func (p *parser) skipLines(depth int) {
+	for {
+		tk := p.peek()
+		if tk.Type == lexer.TokenEOF {
+			return
+		}
+
+		p.take()
+
+		if tk.Type == lexer.TokenNewLine {
+			next := p.peek()
+			if next.Type != lexer.TokenNewLine && next.Depth <= depth {
+				return
+			}
+		}
+	}
+}
+
 func (p *parser) isEOF() bool {
 	return p.tokens[p.index].Type == lexer.TokenEOF
 }
 
-func (p *parser) addErrorAt(err error, Pos lexer.Location) {
+func (p *parser) addErrorAt(err error, rng lexer.Range) {
 	p.errs = append(p.errs, &ParserError{
 		Inner:    err,
-		Location: Pos,
+		Location: rng.Start,
+		End:      rng.End,
 	})
 }
 
@@ -140,7 +203,7 @@ func (p *parser) addError(err error) {
 
 	}
 
-	p.addErrorAt(err, p.tokens[p.index].Start)
+	p.addErrorAt(err, p.tokens[p.index].Range())
 }
 
 func (p *parser) parseFile() *File {
@@ -153,6 +216,17 @@ func (p *parser) parseFile() *File {
 		Nodes:   nodes,
 		Args:    p.args,
 		Imports: p.imports,
+		Extends: p.extends,
+	}
+
+	if f.Extends != nil {
+		for _, n := range f.Nodes {
+			switch n.(type) {
+			case *NodeBlock, *NodeMixinDef, *NodeUse:
+			default:
+				p.addErrorAt(errors.New("only blocks, mixin definitions and uses are allowed in a template that extends another"), n.Range())
+			}
+		}
 	}
 
 	return &f
@@ -171,8 +245,9 @@ func (p *parser) parseNodesBlock(depth int) (nodes []Node) {
 		}
 
 		if tk.Depth > depth {
-			p.addErrorAt(errors.New("unexpected indentation"), tk.Start)
-			break
+			p.addErrorAt(errors.New("unexpected indentation"), tk.Range())
+			p.skipLines(depth)
+			continue
 		}
 		if tk.Depth < depth {
 			p.rewind()
@@ -180,8 +255,14 @@ func (p *parser) parseNodesBlock(depth int) (nodes []Node) {
 		}
 
 		p.rewind()
+
+		errCount := len(p.errs)
 		node := p.parseNode(lastIf != nil)
 
+		if len(p.errs) > errCount && !p.isLineStart() {
+			p.skipLines(depth)
+		}
+
 		if node == nil {
 			continue
 		}
@@ -190,8 +271,18 @@ func (p *parser) parseNodesBlock(depth int) (nodes []Node) {
 			switch st.Keyword {
 			case KeywordIf:
 				lastIf = st
+			case KeywordElseIf:
+				if lastIf != nil {
+					lastIf.HasElse = true
+				}
+				lastIf = st
 			case KeywordElse:
-				lastIf.HasElse = true
+				if lastIf != nil {
+					lastIf.HasElse = true
+				}
+				lastIf = nil
+			default:
+				lastIf = nil
 			}
 		} else {
 			lastIf = nil
@@ -200,6 +291,8 @@ func (p *parser) parseNodesBlock(depth int) (nodes []Node) {
 		nodes = append(nodes, node)
 	}
 
+	trimOuterWhitespace(nodes)
+
 	return nodes
 }
 
@@ -220,7 +313,7 @@ func (p *parser) parseNode(hasSeenIf bool) Node {
 		}
 
 		return &NodeComment{
-			Pos:  Pos(tk.Start),
+			Pos:  Pos(tk.Range()),
 			Text: tkText.Contents,
 		}
 
@@ -229,88 +322,134 @@ func (p *parser) parseNode(hasSeenIf bool) Node {
 		return p.parseKeyword()
 
 	case lexer.TokenIdentifier:
-		return p.parseTag(tk.Depth, tk.Start, tk.Contents)
+		return p.parseTag(tk.Depth, tk.Range(), tk.Contents)
 
 	case lexer.TokenDot, lexer.TokenHashtag:
 		p.rewind()
-		return p.parseTag(tk.Depth, tk.Start, "div")
+		return p.parseTag(tk.Depth, tk.Range(), "div")
 
 	case lexer.TokenInterpolationStart:
 		tkKeyword := p.take()
 
 		if tkKeyword.Type == lexer.TokenGoBlock {
 			return &NodeGoBlock{
-				Pos:      Pos(tkKeyword.Start),
+				Pos:      Pos(tkKeyword.Range()),
 				Contents: tkKeyword.Contents,
 			}
 		}
+		if tkKeyword.Type == lexer.TokenGoExpr {
+			return p.parseGoLine(tkKeyword)
+		}
 
 		stmt := NodeGoStatement{
-			Pos:     Pos(tkKeyword.Start),
+			Pos:     Pos(tkKeyword.Range()),
 			Keyword: StatementKeyword(tkKeyword.Contents),
 		}
 
+		if tkKeyword.Type == lexer.TokenKeyword && stmt.Keyword == KeywordElse {
+			if tkIf := p.peek(); tkIf.Type == lexer.TokenKeyword && tkIf.Contents == "if" {
+				p.take()
+
+				stmt.Keyword = KeywordElseIf
+				stmt.Pos = spanPos(tkKeyword, tkIf)
+			}
+		}
+
 		switch stmt.Keyword {
-		case KeywordIf, KeywordFor:
-			tk, ok := p.mustTake(lexer.TokenGoExpr)
+		case KeywordIf, KeywordElseIf, KeywordFor, KeywordSwitch, KeywordCase:
+			tkExpr, ok := p.mustTake(lexer.TokenGoExpr)
 			if !ok {
 				return nil
 			}
-			stmt.Argument = tk.Contents
+			stmt.Argument = tkExpr.Contents
 
-		case KeywordElse:
-			if !hasSeenIf {
-				p.addErrorAt(errors.New(`found "else" without matching "if"`), tkKeyword.Start)
+			// "for" and "switch" can be used on their own
+			if stmt.Argument == "" && stmt.Keyword != KeywordFor && stmt.Keyword != KeywordSwitch {
+				p.addErrorAt(fmt.Errorf("expected an expression after %q", stmt.Keyword), stmt.Range())
 			}
 
+		case KeywordElse, KeywordDefault:
+
 		default:
 			p.addErrorAt(&UnexpectedTokenError{
 				Got:      tkKeyword,
 				Expected: "a valid Go statement or block",
-			}, tkKeyword.Start)
+			}, tkKeyword.Range())
 			return nil
 		}
 
+		switch stmt.Keyword {
+		case KeywordElse, KeywordElseIf:
+			if !hasSeenIf {
+				p.addErrorAt(fmt.Errorf("found %q without matching \"if\"", stmt.Keyword), stmt.Range())
+			}
+
+		case KeywordCase, KeywordDefault:
+			if !p.inSwitch {
+				p.addErrorAt(fmt.Errorf("found %q outside of a switch", stmt.Keyword), stmt.Range())
+			}
+		}
+
+		wasInSwitch := p.inSwitch
+		p.inSwitch = stmt.Keyword == KeywordSwitch
 		stmt.Nodes = p.parseNodesBlock(tk.Depth + 1)
+		p.inSwitch = wasInSwitch
+
+		if stmt.Keyword == KeywordSwitch {
+			for _, n := range stmt.Nodes {
+				if st, ok := n.(*NodeGoStatement); !ok || (st.Keyword != KeywordCase && st.Keyword != KeywordDefault) {
+					p.addErrorAt(errors.New(`only "case" and "default" are allowed inside a switch`), n.Range())
+				}
+			}
+		}
 
 		return &stmt
 
-	case lexer.TokenPipe:
+	case lexer.TokenPipe, lexer.TokenApostrophe:
 		var val Value
 
-		if p.peek().Type == lexer.TokenNewLine {
+		if p.peek().Type != lexer.TokenNewLine {
+			val = p.parseInlineValue()
+		} else if tk.Type == lexer.TokenPipe {
 			val = ValueLiteral{
 				Contents: "\n",
 			}
-		} else {
-			val = p.parseInlineValue()
+		}
+
+		// Apostrophes are followed by a space, so that they can be joined
+		// with the next piece of text
+		if tk.Type == lexer.TokenApostrophe {
+			val = concatValues(val, ValueLiteral{
+				Contents: " ",
+			})
 		}
 
 		return &NodeText{
-			Pos:  Pos(tk.Start),
+			Pos:  Pos(tk.Range()),
 			Text: val,
 		}
 
 	case lexer.TokenPlus:
-		return p.parseMixinCall(tk.Start)
+		return p.parseMixinCall(tk)
 	}
 
 	p.addErrorAt(&UnexpectedTokenError{
 		Got:      tk,
 		Expected: "a valid node",
-	}, tk.Start)
+	}, tk.Range())
 	return nil
 }
 
-func (p *parser) parseTag(depth int, start lexer.Location, name string) Node {
+func (p *parser) parseTag(depth int, rng lexer.Range, name string) Node {
 	tagNode := NodeTag{
-		Pos:  Pos(start),
+		Pos:  Pos(rng),
 		Name: name,
 	}
 	_, tagNode.IsSelfClosing = selfClosingTags[name]
 
 	var classes []string
 	var idTok *lexer.Token
+	isInline := false
 
 loop:
 	for {
@@ -336,8 +475,43 @@ loop:
 		case lexer.TokenParenOpen:
 			tagNode.Attributes = p.parseTagAttributes()
 
+		case lexer.TokenGreaterThan:
+			tagNode.TrimOuter = true
+
+		case lexer.TokenLessThan:
+			tagNode.TrimInner = true
+
+		case lexer.TokenAmpersand:
+			if _, ok := p.mustTake(lexer.TokenKeyword); !ok {
+				continue
+			}
+			tkExpr, ok := p.mustTake(lexer.TokenGoExpr)
+			if !ok {
+				continue
+			}
+
+			if tagNode.SpreadAttributes != "" {
+				p.addErrorAt(errors.New(`an element can only have one "&attributes"`), tkExpr.Range())
+			}
+
+			// Remove the parentheses around the expression
+			tagNode.SpreadAttributes = tkExpr.Contents[1 : len(tkExpr.Contents)-1]
+
 		case lexer.TokenColon:
-			var txt strings.Builder
+			// Lines are followed by a newline by default, "-" only puts
+			// them between lines and ">" joins them with spaces
+			sep, trailing := "\n", true
+
+			switch p.peek().Type {
+			case lexer.TokenMinus:
+				p.take()
+				trailing = false
+			case lexer.TokenGreaterThan:
+				p.take()
+				sep, trailing = " ", false
+			}
+
+			var lines []string
 
 			for {
 				tkLine := p.peek()
@@ -349,38 +523,62 @@ loop:
 					p.addErrorAt(&UnexpectedTokenError{
 						Got:      tkLine,
 						Expected: "some block text",
-					}, tkLine.Start)
+					}, tkLine.Range())
 					break
 				}
 
 				p.take()
-				txt.WriteString(tkLine.Contents)
-				txt.WriteByte('\n')
+				lines = append(lines, tkLine.Contents)
+			}
+
+			txt := strings.Join(lines, sep)
+			if trailing && len(lines) > 0 {
+				txt += sep
 			}
 
 			tagNode.Nodes = append(tagNode.Nodes, &NodeText{
-				Pos:  Pos(tk.Start),
-				Text: ValueLiteral{Contents: txt.String()},
+				Pos:  Pos(tk.Range()),
+				Text: ValueLiteral{Contents: txt},
 			})
 			break loop
 
 		case lexer.TokenNewLine, lexer.TokenEOF:
 			break loop
 
+		case lexer.TokenBracketClose:
+			// End of an inline tag, which can't have any children
+			isInline = true
+			break loop
+
+		case lexer.TokenTilde:
+			// The rest of the line is the only child, and the following
+			// indented lines belong to it
+			if child := p.parseNode(false); child != nil {
+				tagNode.Nodes = append(tagNode.Nodes, child)
+			}
+			break loop
+
 		default:
 			p.rewind()
 
 			v := p.parseInlineValue()
 			if v != nil {
 				tagNode.Nodes = append(tagNode.Nodes, &NodeText{
-					Pos:  Pos(v.Position()),
+					Pos:  Pos(v.Range()),
 					Text: v,
 				})
 			}
 		}
 	}
 
-	tagNode.Nodes = append(tagNode.Nodes, p.parseNodesBlock(depth+1)...)
+	if !isInline {
+		tagNode.Nodes = append(tagNode.Nodes, p.parseNodesBlock(depth+1)...)
+	}
+
+	if tagNode.TrimInner && len(tagNode.Nodes) > 0 {
+		trimNodeLeft(tagNode.Nodes[0])
+		trimNodeRight(tagNode.Nodes[len(tagNode.Nodes)-1])
+	}
 
 	if len(classes) > 0 {
 		classAttrIdx := slices.IndexFunc(tagNode.Attributes, func(e TagAttribute) bool {
@@ -388,18 +586,22 @@ loop:
 		})
 		joined := strings.Join(classes, " ")
 
+		attr := TagAttribute{
+			Name: "class",
+			Value: ValueLiteral{
+				Contents: joined,
+			},
+		}
+
 		if classAttrIdx < 0 {
-			tagNode.Attributes = append(tagNode.Attributes, TagAttribute{
-				Name: "class",
-				Value: ValueLiteral{
-					Contents: joined,
-				},
-			})
-		} else {
-			attr := &tagNode.Attributes[classAttrIdx]
-			attr.Value = concatValues(attr.Value, ValueLiteral{
+			tagNode.Attributes = append(tagNode.Attributes, attr)
+		} else if lit, ok := tagNode.Attributes[classAttrIdx].Value.(ValueLiteral); ok && tagNode.Attributes[classAttrIdx].Condition == "" {
+			tagNode.Attributes[classAttrIdx].Value = concatValues(lit, ValueLiteral{
 				Contents: " " + joined,
 			})
+		} else {
+			// Dynamic class lists are merged by the generator
+			tagNode.Attributes = slices.Insert(tagNode.Attributes, classAttrIdx+1, attr)
 		}
 	}
 
@@ -410,10 +612,10 @@ loop:
 
 		if !hasIDAttr {
 			tagNode.Attributes = append(tagNode.Attributes, TagAttribute{
-				Pos:  Pos(idTok.Start),
+				Pos:  Pos(idTok.Range()),
 				Name: "id",
 				Value: ValueLiteral{
-					Pos:      Pos(idTok.Start),
+					Pos:      Pos(idTok.Range()),
 					Contents: idTok.Contents,
 				},
 			})
@@ -435,7 +637,13 @@ func (p *parser) parseTagAttributes() []TagAttribute {
 			p.addErrorAt(&UnexpectedTokenError{
 				Got:      tkName,
 				Expected: "an attribute name",
-			}, tkName.Start)
+			}, tkName.Range())
+
+			// Leave the end of the line for the caller, so that parsing
+			// continues from the next line
+			if tkName.Type == lexer.TokenNewLine || tkName.Type == lexer.TokenEOF {
+				p.rewind()
+			}
 			break
 		}
 
@@ -449,34 +657,25 @@ func (p *parser) parseTagAttributes() []TagAttribute {
 
 			value = p.parseAttributeValue()
 			if value == nil {
-				continue
-			}
-
-		case lexer.TokenQuestionMark:
-			p.take()
-
-			if _, ok := p.mustTake(lexer.TokenEquals); !ok {
-				continue
-			}
-
-			tkCond, ok := p.mustTake(lexer.TokenGoExpr)
-			if !ok {
-				continue
+				return attrs
 			}
 
-			cond = tkCond.Contents
-			value = ValueLiteral{
-				Contents: tkName.Contents,
+			if p.peek().Type == lexer.TokenQuestionMark {
+				var ok bool
+				if cond, ok = p.parseAttributeCondition(); !ok {
+					return attrs
+				}
 			}
 
-		default:
-			value = ValueLiteral{
-				Contents: tkName.Contents,
+		case lexer.TokenQuestionMark:
+			var ok bool
+			if cond, ok = p.parseAttributeCondition(); !ok {
+				return attrs
 			}
 		}
 
 		attrs = append(attrs, TagAttribute{
-			Pos:       Pos(tkName.Start),
+			Pos:       spanPos(tkName, &p.tokens[p.index-1]),
 			Name:      tkName.Contents,
 			Value:     value,
 			Condition: cond,
@@ -486,6 +685,23 @@ func (p *parser) parseTagAttributes() []TagAttribute {
 	return attrs
 }
 
+// parseAttributeCondition parses a "?=" followed by a Go expression.
+func (p *parser) parseAttributeCondition() (cond string, ok bool) {
+	if _, ok := p.mustTake(lexer.TokenQuestionMark); !ok {
+		return "", false
+	}
+	if _, ok := p.mustTake(lexer.TokenEquals); !ok {
+		return "", false
+	}
+
+	tkCond, ok := p.mustTake(lexer.TokenGoExpr)
+	if !ok {
+		return "", false
+	}
+
+	return tkCond.Contents, true
+}
+
 func (p *parser) parseAttributeValue() Value {
 	var val Value
 
@@ -496,14 +712,30 @@ loop:
 		switch tk.Type {
 		case lexer.TokenQuotedString:
 			val = concatValues(val, ValueLiteral{
-				Pos:      Pos(tk.Start),
-				Contents: strings.TrimPrefix(strings.TrimSuffix(tk.Contents, `"`), `"`),
+				Pos:      Pos(tk.Range()),
+				Contents: tk.Contents,
 			})
 
-		case lexer.TokenGoExpr:
+		case lexer.TokenInterpolationStart:
+			// Interpolations in quoted values are followed by the expression
+			continue
+
+		case lexer.TokenGoExpr, lexer.TokenExclamationPoint:
+			escape := true
+
+			if tk.Type == lexer.TokenExclamationPoint {
+				escape = false
+
+				var ok bool
+				if tk, ok = p.mustTake(lexer.TokenGoExpr); !ok {
+					break loop
+				}
+			}
+
 			val = concatValues(val, ValueGoExpr{
-				Pos:      Pos(tk.Start),
+				Pos:      Pos(tk.Range()),
 				Contents: tk.Contents,
+				Escape:   escape,
 			})
 
 		default:
@@ -511,10 +743,9 @@ loop:
 				p.addErrorAt(&UnexpectedTokenError{
 					Got:      tk,
 					Expected: "an attribute value",
-				}, tk.Start)
-			} else {
-				p.rewind()
+				}, tk.Range())
 			}
+			p.rewind()
 			break loop
 		}
 	}
@@ -532,7 +763,7 @@ loop:
 		switch tk.Type {
 		case lexer.TokenInlineText:
 			val = concatValues(val, ValueLiteral{
-				Pos:      Pos(tk.Start),
+				Pos:      Pos(tk.Range()),
 				Contents: tk.Contents,
 			})
 
@@ -552,9 +783,22 @@ loop:
 			}
 
 			val = concatValues(val, ValueGoExpr{
-				Pos:        Pos(tk.Start),
-				Contents:   tk.Contents,
-				EscapeHTML: escape,
+				Pos:      Pos(tk.Range()),
+				Contents: tk.Contents,
+				Escape:   escape,
+			})
+
+		case lexer.TokenInlineTagStart:
+			tkName, ok := p.mustTake(lexer.TokenIdentifier)
+			if !ok {
+				continue
+			}
+
+			tag := p.parseTag(tkName.Depth, tkName.Range(), tkName.Contents).(*NodeTag)
+
+			val = concatValues(val, ValueTag{
+				Pos: Pos{Start: tk.Start, End: p.tokens[p.index-1].End},
+				Tag: tag,
 			})
 
 		case lexer.TokenEOF:
@@ -562,10 +806,10 @@ loop:
 
 		default:
 			if val == nil {
-				p.addError(&UnexpectedTokenError{
+				p.addErrorAt(&UnexpectedTokenError{
 					Got:      tk,
 					Expected: "an inline value",
-				})
+				}, tk.Range())
 			} else {
 				p.rewind()
 			}
@@ -576,6 +820,35 @@ loop:
 	return val
 }
 
+// parseGoLine parses a single line Go statement, checking that its syntax is
+// valid.
+func (p *parser) parseGoLine(tk *lexer.Token) Node {
+	src := "package p\nfunc _() {\n" + tk.Contents + "\n}\n"
+
+	_, err := goparser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		rng := tk.Range()
+
+		var errs scanner.ErrorList
+		if errors.As(err, &errs) && len(errs) > 0 {
+			err = errors.New(errs[0].Msg)
+
+			// Point at the error if it's in the statement's line
+			if errs[0].Pos.Line == 3 {
+				rng.Start.Column += errs[0].Pos.Column - 1
+			}
+		}
+
+		p.addErrorAt(fmt.Errorf("invalid Go statement: %w", err), rng)
+		return nil
+	}
+
+	return &NodeGoLine{
+		Pos:      Pos(tk.Range()),
+		Contents: tk.Contents,
+	}
+}
+
 func (p *parser) parseKeyword() Node {
 	tk, ok := p.mustTake(lexer.TokenKeyword)
 	if !ok {
@@ -605,7 +878,17 @@ func (p *parser) parseKeyword() Node {
 		return p.parseMixinDef()
 
 	case "include":
-		return p.parseInclude(tk.Start)
+		return p.parseInclude(tk)
+
+	case "extends":
+		p.parseExtends(tk)
+		return nil
+
+	case "use":
+		return p.parseUse(tk)
+
+	case "block":
+		return p.parseBlock(tk)
 
 	case "doctype":
 		tkValue, ok := p.mustTake(lexer.TokenInlineText)
@@ -622,12 +905,12 @@ func (p *parser) parseKeyword() Node {
 			p.addErrorAt(&UnexpectedTokenError{
 				Got:      tkValue,
 				Expected: "a known doctype shorthand value",
-			}, tkValue.Start)
+			}, tkValue.Range())
 			return nil
 		}
 
 		return &NodeDoctype{
-			Pos:   Pos(tk.Start),
+			Pos:   Pos(tk.Range()),
 			Value: value,
 		}
 	}
@@ -635,7 +918,7 @@ func (p *parser) parseKeyword() Node {
 	p.addErrorAt(&UnexpectedTokenError{
 		Got:      tk,
 		Expected: "a known keyword",
-	}, tk.Start)
+	}, tk.Range())
 	return nil
 }
 
@@ -646,12 +929,14 @@ func (p *parser) parseMixinDef() Node {
 	}
 
 	mixin := NodeMixinDef{
-		Pos:  Pos(tkName.Start),
+		Pos:  Pos(tkName.Range()),
 		Name: tkName.Contents,
 	}
 
 	tk := p.take()
-	if tk.Type == lexer.TokenParenOpen {
+	if tk.Type == lexer.TokenParenOpen && p.peek().Type == lexer.TokenParenClose {
+		p.take()
+	} else if tk.Type == lexer.TokenParenOpen {
 		// Parse arguments
 		for {
 			tkName, ok := p.mustTake(lexer.TokenIdentifier)
@@ -676,7 +961,7 @@ func (p *parser) parseMixinDef() Node {
 				p.addErrorAt(&UnexpectedTokenError{
 					Got:      tk,
 					Expected: "comma or right parenthesis",
-				}, tk.Start)
+				}, tk.Range())
 				break
 			}
 		}
@@ -684,26 +969,33 @@ func (p *parser) parseMixinDef() Node {
 		p.addErrorAt(&UnexpectedTokenError{
 			Got:      tk,
 			Expected: "a newline or arguments",
-		}, tk.Start)
+		}, tk.Range())
 		return nil
 	}
 
 	// Parse children
+	wasInMixinDef := p.inMixinDef
+	p.inMixinDef = true
 	mixin.Nodes = p.parseNodesBlock(tkName.Depth + 1)
+	p.inMixinDef = wasInMixinDef
 
 	return &mixin
 }
 
-func (p *parser) parseMixinCall(start lexer.Location) Node {
+func (p *parser) parseMixinCall(tkPlus *lexer.Token) Node {
 	tkName, ok := p.mustTake(lexer.TokenIdentifier)
 	if !ok {
 		return nil
 	}
 
+	tkEnd := tkName
+
 	args := []string{}
 
 	tk := p.take()
-	if tk.Type == lexer.TokenParenOpen {
+	if tk.Type == lexer.TokenParenOpen && p.peek().Type == lexer.TokenParenClose {
+		tkEnd = p.take()
+	} else if tk.Type == lexer.TokenParenOpen {
 		// Parse arguments
 		for {
 			tk, ok := p.mustTake(lexer.TokenGoExpr)
@@ -715,43 +1007,65 @@ func (p *parser) parseMixinCall(start lexer.Location) Node {
 
 			tk = p.take()
 			if tk.Type == lexer.TokenParenClose {
+				tkEnd = tk
 				break
 			} else if tk.Type != lexer.TokenComma {
 				p.addErrorAt(&UnexpectedTokenError{
 					Got:      tk,
 					Expected: "a comma or a right parenthesis",
-				}, tk.Start)
+				}, tk.Range())
 			}
 		}
 	} else if tk.Type != lexer.TokenNewLine && tk.Type != lexer.TokenEOF {
 		p.addErrorAt(&UnexpectedTokenError{
 			Got:      tk,
 			Expected: "a newline or arguments",
-		}, tk.Start)
+		}, tk.Range())
 		return nil
 	}
 
-	return &NodeMixinCall{
-		Pos:  Pos(start),
+	call := NodeMixinCall{
+		Pos:  spanPos(tkPlus, tkEnd),
 		Name: tkName.Contents,
 		Args: args,
 	}
+
+	if tk.Type == lexer.TokenParenOpen && p.peek().Type == lexer.TokenParenOpen {
+		p.take()
+		call.Attributes = p.parseTagAttributes()
+
+		if tk := p.take(); tk.Type != lexer.TokenNewLine && tk.Type != lexer.TokenEOF {
+			p.addErrorAt(&UnexpectedTokenError{
+				Got:      tk,
+				Expected: "a newline",
+			}, tk.Range())
+			return nil
+		}
+	}
+
+	// Parse block contents
+	prevCallDepth := p.mixinCallDepth
+	p.mixinCallDepth = tkName.Depth + 1
+	call.Nodes = p.parseNodesBlock(tkName.Depth + 1)
+	p.mixinCallDepth = prevCallDepth
+
+	return &call
 }
 
-func (p *parser) parseInclude(start lexer.Location) Node {
+func (p *parser) parseInclude(tkKeyword *lexer.Token) Node {
 	tkPath, ok := p.mustTake(lexer.TokenImportPath)
 	if !ok {
 		return nil
 	}
 
 	fname := tkPath.Contents
-	if !strings.ContainsRune(fname, '.') {
+	if filepath.Ext(fname) == "" {
 		fname += ".poo"
 	}
 
 	file, err := p.loadFile(fname)
 	if err != nil {
-		p.addErrorAt(fmt.Errorf("load included file: %w", err), tkPath.Start)
+		p.addErrorAt(fmt.Errorf("load included file: %w", err), tkPath.Range())
 		return nil
 	}
 
@@ -759,12 +1073,149 @@ func (p *parser) parseInclude(start lexer.Location) Node {
 	p.imports = append(p.imports, file.Imports...)
 
 	return &NodeInclude{
-		Pos:  Pos(start),
+		Pos:  spanPos(tkKeyword, tkPath),
 		File: file,
 		Path: tkPath.Contents,
 	}
 }
 
+func (p *parser) parseUse(tkKeyword *lexer.Token) Node {
+	tkPath, ok := p.mustTake(lexer.TokenImportPath)
+	if !ok {
+		return nil
+	}
+
+	use := NodeUse{
+		Pos:  spanPos(tkKeyword, tkPath),
+		Path: tkPath.Contents,
+	}
+
+	if tk := p.peek(); tk.Type == lexer.TokenKeyword && tk.Contents == "as" {
+		p.take()
+
+		tkPkg, ok := p.mustTake(lexer.TokenQuotedString)
+		if !ok {
+			return nil
+		}
+
+		// Mixins are called through GoPackageName, so the package is
+		// imported with that name in case it's a different one
+		use.GoPackage = strings.Trim(tkPkg.Contents, `"`)
+		p.imports = append(p.imports, use.GoPackageName()+" "+tkPkg.Contents)
+	}
+
+	fname := tkPath.Contents
+	if filepath.Ext(fname) == "" {
+		fname += ".poo"
+	}
+
+	file, err := p.loadFile(fname)
+	if err != nil {
+		p.addErrorAt(fmt.Errorf("load used file: %w", err), tkPath.Range())
+		return nil
+	}
+
+	if use.GoPackage == "" {
+		p.imports = append(p.imports, file.Imports...)
+	}
+	use.File = file
+
+	return &use
+}
+
+func (p *parser) parseExtends(tkKeyword *lexer.Token) {
+	tkPath, ok := p.mustTake(lexer.TokenImportPath)
+	if !ok {
+		return
+	}
+
+	if p.extends != nil {
+		p.addErrorAt(errors.New("a template can only extend one other template"), spanPos(tkKeyword, tkPath).Range())
+		return
+	}
+
+	fname := tkPath.Contents
+	if filepath.Ext(fname) == "" {
+		fname += ".poo"
+	}
+
+	file, err := p.loadFile(fname)
+	if err != nil {
+		p.addErrorAt(fmt.Errorf("load extended file: %w", err), tkPath.Range())
+		return
+	}
+
+	p.extends = file
+}
+
+func (p *parser) parseBlock(tkKeyword *lexer.Token) Node {
+	var names []string
+
+	for p.peek().Type == lexer.TokenIdentifier {
+		names = append(names, p.take().Contents)
+	}
+
+	// Blocks directly inside a mixin call provide the contents for that block,
+	// other blocks inside a mixin definition are where the contents are placed
+	isCallContents := len(names) > 0 && tkKeyword.Depth == p.mixinCallDepth
+
+	if p.inMixinDef && !isCallContents {
+		slot := NodeMixinSlot{
+			Pos: Pos(tkKeyword.Range()),
+		}
+
+		switch len(names) {
+		case 0:
+		case 1:
+			slot.Name = names[0]
+		default:
+			p.addErrorAt(&UnexpectedTokenError{
+				Got:      tkKeyword,
+				Expected: "an optional mixin block name",
+			}, tkKeyword.Range())
+			return nil
+		}
+
+		slot.Nodes = p.parseNodesBlock(tkKeyword.Depth + 1)
+
+		return &slot
+	}
+
+	block := NodeBlock{
+		Pos: Pos(tkKeyword.Range()),
+	}
+
+	switch {
+	case len(names) == 1:
+		block.Name = names[0]
+
+	case len(names) == 2 && names[0] == "append":
+		block.Name = names[1]
+		block.Mode = BlockAppend
+
+	case len(names) == 2 && names[0] == "prepend":
+		block.Name = names[1]
+		block.Mode = BlockPrepend
+
+	default:
+		p.addErrorAt(&UnexpectedTokenError{
+			Got:      tkKeyword,
+			Expected: `a block name, optionally preceded by "append" or "prepend"`,
+		}, tkKeyword.Range())
+		return nil
+	}
+
+	block.Nodes = p.parseNodesBlock(tkKeyword.Depth + 1)
+
+	return &block
+}
+
+// spanPos returns the position spanning from the start of the first token to
+// the end of the last one.
+func spanPos(first, last *lexer.Token) Pos {
+	return Pos{Start: first.Start, End: last.End}
+}
+
 func concatValues(a, b Value) Value {
 	if a == nil {
 		return b
@@ -773,8 +1224,29 @@ func concatValues(a, b Value) Value {
 		return a
 	}
 
+	// Join consecutive literals so that values without any Go expressions
+	// are kept as a single literal
+	if bLit, ok := b.(ValueLiteral); ok {
+		switch a := a.(type) {
+		case ValueLiteral:
+			return ValueLiteral{
+				Pos:      Pos{Start: a.Start, End: bLit.End},
+				Contents: a.Contents + bLit.Contents,
+			}
+
+		case ValueConcat:
+			if aLit, ok := a.B.(ValueLiteral); ok {
+				return ValueConcat{
+					Pos: Pos{Start: a.Start, End: bLit.End},
+					A:   a.A,
+					B:   concatValues(aLit, bLit),
+				}
+			}
+		}
+	}
+
 	return ValueConcat{
-		Pos: Pos(a.Position()),
+		Pos: Pos{Start: a.Range().Start, End: b.Range().End},
 		A:   a,
 		B:   b,
 	}
@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/pipe01/poodle/internal/lexer"
+	. "github.com/pipe01/poodle/internal/parser/ast"
+)
+
+// parseAll lexes and parses src, returning the parser errors. Lines with lexer
+// errors are skipped by the lexer, like the workspace does.
+func parseAll(t *testing.T, src string) (*File, []error) {
+	t.Helper()
+
+	tks, _ := lexer.New([]byte(src), "test.poo").CollectAll()
+
+	return ParseAll(tks, nil)
+}
+
+func TestTagAttributesErrorRecovery(t *testing.T) {
+	f, errs := parseAll(t, "p(&)\np ok\n")
+
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1: %v", len(errs), errs)
+	}
+
+	perr, ok := errs[0].(*ParserError)
+	if !ok {
+		t.Fatalf("got error of type %T, want *ParserError", errs[0])
+	}
+	if line := perr.Location.Line; line != 0 {
+		t.Errorf("error is on line %d, want 0", line)
+	}
+
+	// The line after the error is still parsed
+	if len(f.Nodes) != 2 {
+		t.Fatalf("got %d nodes, want 2", len(f.Nodes))
+	}
+	tag, ok := f.Nodes[1].(*NodeTag)
+	if !ok || tag.Name != "p" || len(tag.Nodes) != 1 {
+		t.Fatalf("got %#v, want a p element with text", f.Nodes[1])
+	}
+	if text, ok := tag.Nodes[0].(*NodeText); !ok || text.Text.(ValueLiteral).Contents != "ok" {
+		t.Errorf("got %#v, want text \"ok\"", tag.Nodes[0])
+	}
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+
+	. "github.com/pipe01/poodle/internal/parser/ast"
+)
+
+// trimOuterWhitespace removes the whitespace next to the tags in nodes that
+// trim their outer whitespace, from the text nodes that surround them.
+func trimOuterWhitespace(nodes []Node) {
+	for i, n := range nodes {
+		if tag, ok := n.(*NodeTag); !ok || !tag.TrimOuter {
+			continue
+		}
+
+		if i > 0 {
+			trimNodeRight(nodes[i-1])
+		}
+		if i < len(nodes)-1 {
+			trimNodeLeft(nodes[i+1])
+		}
+	}
+}
+
+// trimNodeLeft removes the leading whitespace of n if it's a text node that
+// starts with a literal.
+func trimNodeLeft(n Node) {
+	if txt, ok := n.(*NodeText); ok {
+		txt.Text = trimValueLeft(txt.Text)
+	}
+}
+
+// trimNodeRight removes the trailing whitespace of n if it's a text node that
+// ends with a literal.
+func trimNodeRight(n Node) {
+	if txt, ok := n.(*NodeText); ok {
+		txt.Text = trimValueRight(txt.Text)
+	}
+}
+
+func trimValueLeft(v Value) Value {
+	switch v := v.(type) {
+	case ValueLiteral:
+		v.Contents = strings.TrimLeftFunc(v.Contents, unicode.IsSpace)
+		return v
+
+	case ValueConcat:
+		v.A = trimValueLeft(v.A)
+		return v
+	}
+
+	return v
+}
+
+func trimValueRight(v Value) Value {
+	switch v := v.(type) {
+	case ValueLiteral:
+		v.Contents = strings.TrimRightFunc(v.Contents, unicode.IsSpace)
+		return v
+
+	case ValueConcat:
+		v.B = trimValueRight(v.B)
+		return v
+	}
+
+	return v
+}
@@ -0,0 +1,302 @@
+package typecheck
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pipe01/poodle/internal/lexer"
+	"github.com/pipe01/poodle/internal/parser/ast"
+	"github.com/pipe01/poodle/internal/workspace"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
+)
+
+type TypeError struct {
+	Inner         error
+	Location, End lexer.Location
+}
+
+func (e *TypeError) Unwrap() error {
+	return e.Inner
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("%s at %s", e.Inner, &e.Location)
+}
+
+func (e *TypeError) At() lexer.Location {
+	return e.Location
+}
+
+func (e *TypeError) Range() lexer.Range {
+	return lexer.Range{Start: e.Location, End: e.End}
+}
+
+// Check type-checks src, the code generated for f that would be written to
+// outPath, together with the rest of the Go package in outPath's directory.
+//
+// src must have been generated with line directives enabled, they are used to
+// map errors back to the node they come from. rootPath is the directory that
+// template file names are relative to.
+func Check(outPath string, src []byte, f *ast.File, rootPath string) error {
+	outPath, err := filepath.Abs(outPath)
+	if err != nil {
+		return fmt.Errorf("get absolute output path: %w", err)
+	}
+	rootPath, err = filepath.Abs(rootPath)
+	if err != nil {
+		return fmt.Errorf("get absolute root path: %w", err)
+	}
+
+	// Generated files rely on goimports to add and remove imports, if this
+	// fails the syntax error will be reported by the loader below
+	if fixed, err := imports.Process(outPath, src, nil); err == nil {
+		src = fixed
+	}
+
+	cfg := &packages.Config{
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedTypes | packages.NeedSyntax,
+		Dir:     filepath.Dir(outPath),
+		Overlay: map[string][]byte{outPath: src},
+	}
+
+	pkgs, err := packages.Load(cfg, ".")
+	if err != nil {
+		return fmt.Errorf("load package: %w", err)
+	}
+
+	c := checker{
+		outPath:  outPath,
+		rootPath: rootPath,
+		lines:    strings.Split(string(src), "\n"),
+		ranges:   nodeRanges(f),
+	}
+
+	var errs workspace.ErrorList
+
+	for _, pkg := range pkgs {
+		for _, e := range pkg.Errors {
+			// Type errors are handled below, they have more precise positions
+			if e.Kind == packages.TypeError {
+				continue
+			}
+			// The package is also compiled to get its export data, which fails
+			// with the same errors that are reported individually
+			if e.Kind == packages.ListError && strings.HasPrefix(e.Msg, "# "+pkg.PkgPath+"\n") {
+				continue
+			}
+
+			errs = append(errs, c.packageError(e))
+		}
+
+		for _, e := range pkg.TypeErrors {
+			pos := e.Fset.PositionFor(e.Pos, false)
+
+			// Ignore errors in other files of the package
+			if pos.Filename != outPath {
+				continue
+			}
+
+			errs = append(errs, c.typeError(e.Msg, pos, e.Fset.Position(e.Pos)))
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+type checker struct {
+	outPath, rootPath string
+
+	// Lines of the generated file
+	lines []string
+
+	ranges []lexer.Range
+}
+
+// typeError maps an error at pos in the generated file to the template, where
+// adjusted is pos after applying line directives.
+func (c *checker) typeError(msg string, pos, adjusted token.Position) error {
+	if adjusted.Filename == c.outPath {
+		return fmt.Errorf("%s at %s", msg, pos)
+	}
+
+	// The line directive sets the column at the start of the generated line
+	// to the column of the node, so subtracting the column in the generated
+	// file gives back the node's column. Inline directives before Go
+	// expressions already give their exact column.
+	loc := lexer.Location{
+		File:   c.templateName(adjusted.Filename),
+		Line:   adjusted.Line - 1,
+		Column: adjusted.Column - pos.Column,
+	}
+	if c.afterInlineDirective(pos) {
+		loc.Column = adjusted.Column - 1
+	}
+
+	return c.errorAt(errors.New(msg), loc)
+}
+
+// packageError converts an error returned while loading the package, whose
+// position has already been adjusted by line directives.
+func (c *checker) packageError(e packages.Error) error {
+	file, line, col, ok := splitPosition(e.Pos)
+	if !ok || file == c.outPath || !strings.HasPrefix(file, c.rootPath) {
+		return e
+	}
+
+	loc := lexer.Location{
+		File:   c.templateName(file),
+		Line:   line - 1,
+		Column: col - 1,
+	}
+
+	return c.errorAt(errors.New(e.Msg), loc)
+}
+
+// afterInlineDirective returns whether there's an inline line directive
+// before pos in its line of the generated file.
+func (c *checker) afterInlineDirective(pos token.Position) bool {
+	if pos.Line < 1 || pos.Line > len(c.lines) {
+		return false
+	}
+
+	line := c.lines[pos.Line-1]
+	if pos.Column-1 < len(line) {
+		line = line[:pos.Column-1]
+	}
+
+	return strings.Contains(line, "/*line ")
+}
+
+func (c *checker) templateName(path string) string {
+	if rel, err := filepath.Rel(c.rootPath, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// errorAt returns an error spanning the smallest node that starts at loc, or
+// that contains it if there's none. If the column isn't known, the first node
+// on the line is used.
+func (c *checker) errorAt(err error, loc lexer.Location) error {
+	rng := lexer.Range{Start: loc, End: loc}
+
+	if loc.Column < 0 {
+		// Inline line directives don't apply to the start of the line, so the
+		// column can't be recovered
+		loc.Column = 0
+		rng = lexer.Range{Start: loc, End: loc}
+
+		found := false
+		for _, r := range c.ranges {
+			if r.Start.File == loc.File && r.Start.Line == loc.Line && (!found || before(r.Start, rng.Start)) {
+				rng = r
+				found = true
+			}
+		}
+	} else if r, ok := smallestRange(c.ranges, func(r lexer.Range) bool { return r.Start == loc }); ok {
+		rng = r
+	} else if r, ok := smallestRange(c.ranges, func(r lexer.Range) bool { return contains(r, loc) }); ok {
+		rng = r
+	}
+
+	return &TypeError{
+		Inner:    err,
+		Location: rng.Start,
+		End:      rng.End,
+	}
+}
+
+// nodeRanges returns the ranges of all nodes, attributes and values in f.
+func nodeRanges(f *ast.File) []lexer.Range {
+	var ranges []lexer.Range
+
+	var addValue func(v ast.Value)
+	addValue = func(v ast.Value) {
+		if v == nil {
+			return
+		}
+
+		ranges = append(ranges, v.Range())
+
+		if v, ok := v.(ast.ValueConcat); ok {
+			addValue(v.A)
+			addValue(v.B)
+		}
+	}
+
+	ast.Inspect(f.Nodes, func(n ast.Node) bool {
+		ranges = append(ranges, n.Range())
+
+		switch n := n.(type) {
+		case *ast.NodeTag:
+			for _, attr := range n.Attributes {
+				ranges = append(ranges, attr.Range())
+				addValue(attr.Value)
+			}
+
+		case *ast.NodeMixinCall:
+			for _, attr := range n.Attributes {
+				ranges = append(ranges, attr.Range())
+				addValue(attr.Value)
+			}
+
+		case *ast.NodeText:
+			addValue(n.Text)
+		}
+
+		return true
+	})
+
+	return ranges
+}
+
+func smallestRange(ranges []lexer.Range, match func(lexer.Range) bool) (rng lexer.Range, ok bool) {
+	for _, r := range ranges {
+		if !match(r) {
+			continue
+		}
+
+		if !ok || before(r.End, rng.End) || (r.End == rng.End && before(rng.Start, r.Start)) {
+			rng = r
+			ok = true
+		}
+	}
+
+	return
+}
+
+func contains(r lexer.Range, loc lexer.Location) bool {
+	return r.Start.File == loc.File && !before(loc, r.Start) && before(loc, r.End)
+}
+
+func before(a, b lexer.Location) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// splitPosition splits a "file:line:col" position string.
+func splitPosition(pos string) (file string, line, col int, ok bool) {
+	parts := strings.Split(pos, ":")
+	if len(parts) < 3 {
+		return "", 0, 0, false
+	}
+
+	line, err1 := strconv.Atoi(parts[len(parts)-2])
+	col, err2 := strconv.Atoi(parts[len(parts)-1])
+	if err1 != nil || err2 != nil {
+		return "", 0, 0, false
+	}
+
+	return strings.Join(parts[:len(parts)-2], ":"), line, col, true
+}
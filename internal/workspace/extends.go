@@ -0,0 +1,132 @@
+package workspace
+
+import (
+	"fmt"
+
+	"github.com/pipe01/poodle/internal/parser"
+	"github.com/pipe01/poodle/internal/parser/ast"
+)
+
+// resolveExtends merges the blocks defined in f into the template it extends,
+// returning a new file that can be generated on its own.
+func resolveExtends(f *ast.File) (*ast.File, error) {
+	overrides := make(map[string]*ast.NodeBlock)
+	var mixins []ast.Node
+
+	for _, n := range f.Nodes {
+		switch n := n.(type) {
+		case *ast.NodeBlock:
+			if _, ok := overrides[n.Name]; ok {
+				return nil, &parser.ParserError{
+					Inner:    fmt.Errorf("block %q is defined more than once", n.Name),
+					Location: n.Position(),
+					End:      n.Range().End,
+				}
+			}
+			overrides[n.Name] = n
+
+		case *ast.NodeMixinDef, *ast.NodeUse:
+			mixins = append(mixins, n)
+		}
+	}
+
+	used := make(map[string]struct{})
+	nodes := mergeBlocks(f.Extends.Nodes, overrides, used)
+
+	for _, n := range f.Nodes {
+		if b, ok := n.(*ast.NodeBlock); ok {
+			if _, ok := used[b.Name]; !ok {
+				return nil, &parser.ParserError{
+					Inner:    fmt.Errorf("block %q not found in extended template", b.Name),
+					Location: b.Position(),
+					End:      b.Range().End,
+				}
+			}
+		}
+	}
+
+	return &ast.File{
+		Name:    f.Name,
+		Nodes:   append(mixins, nodes...),
+		Args:    append(append([]string{}, f.Extends.Args...), f.Args...),
+		Imports: append(append([]string{}, f.Extends.Imports...), f.Imports...),
+	}, nil
+}
+
+// mergeBlocks returns a copy of nodes where the blocks named in overrides have
+// their contents replaced, appended or prepended. Nodes shared with the
+// extended template are never modified.
+func mergeBlocks(nodes []ast.Node, overrides map[string]*ast.NodeBlock, used map[string]struct{}) []ast.Node {
+	merged := make([]ast.Node, 0, len(nodes))
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *ast.NodeBlock:
+			cp := *n
+			cp.Nodes = mergeBlocks(n.Nodes, overrides, used)
+
+			if o, ok := overrides[n.Name]; ok {
+				used[n.Name] = struct{}{}
+
+				switch o.Mode {
+				case ast.BlockReplace:
+					cp.Nodes = o.Nodes
+				case ast.BlockAppend:
+					cp.Nodes = append(cp.Nodes, o.Nodes...)
+				case ast.BlockPrepend:
+					cp.Nodes = append(append([]ast.Node{}, o.Nodes...), cp.Nodes...)
+				}
+			}
+			merged = append(merged, &cp)
+
+		case *ast.NodeTag:
+			cp := *n
+			cp.Nodes = mergeBlocks(n.Nodes, overrides, used)
+			merged = append(merged, &cp)
+
+		case *ast.NodeGoStatement:
+			cp := *n
+			cp.Nodes = mergeBlocks(n.Nodes, overrides, used)
+			merged = append(merged, &cp)
+
+		case *ast.NodeMixinDef:
+			cp := *n
+			cp.Nodes = mergeBlocks(n.Nodes, overrides, used)
+			merged = append(merged, &cp)
+
+		case *ast.NodeMixinCall:
+			// The blocks passed to a mixin aren't the template's, but they may
+			// contain some of the latter
+			cp := *n
+			cp.Nodes = make([]ast.Node, 0, len(n.Nodes))
+			for _, n := range n.Nodes {
+				if b, ok := n.(*ast.NodeBlock); ok {
+					bcp := *b
+					bcp.Nodes = mergeBlocks(b.Nodes, overrides, used)
+					cp.Nodes = append(cp.Nodes, &bcp)
+				} else {
+					cp.Nodes = append(cp.Nodes, mergeBlocks([]ast.Node{n}, overrides, used)...)
+				}
+			}
+			merged = append(merged, &cp)
+
+		case *ast.NodeMixinSlot:
+			cp := *n
+			cp.Nodes = mergeBlocks(n.Nodes, overrides, used)
+			merged = append(merged, &cp)
+
+		case *ast.NodeInclude:
+			file := *n.File
+			file.Nodes = mergeBlocks(n.File.Nodes, overrides, used)
+
+			cp := *n
+			cp.File = &file
+			merged = append(merged, &cp)
+
+		default:
+			merged = append(merged, n)
+		}
+	}
+
+	return merged
+}
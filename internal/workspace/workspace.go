@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pipe01/poodle/internal/lexer"
 	"github.com/pipe01/poodle/internal/parser"
@@ -18,6 +19,22 @@ type Workspace struct {
 	requestedFiles map[string]struct{}
 }
 
+// ErrorList is returned when more than one error is found while loading a file.
+type ErrorList []error
+
+func (e ErrorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+func (e ErrorList) Unwrap() []error {
+	return e
+}
+
 func New(rootPath string) *Workspace {
 	return &Workspace{
 		rootPath:       rootPath,
@@ -30,6 +47,13 @@ func (w *Workspace) RequestedFiles() []string {
 	return maps.Keys(w.requestedFiles)
 }
 
+// RootPath returns the path that file names are relative to.
+func (w *Workspace) RootPath() string {
+	return w.rootPath
+}
+
+// Load lexes and parses the file at relPath. If there are any errors, the
+// partially parsed file is returned along with them.
 func (w *Workspace) Load(relPath string) (*ast.File, error) {
 	return w.load(relPath, func(fullPath, relPath string) ([]byte, error) {
 		w.requestedFiles[fullPath] = struct{}{}
@@ -66,19 +90,48 @@ func (w *Workspace) load(relPath string, getContents func(fullPath, relPath stri
 	}
 
 	l := lexer.New(contents, relPath)
-	tks, err := l.Collect()
-	if err != nil {
-		return nil, fmt.Errorf("lex file: %w", err)
-	}
+	tks, lexErrs := l.CollectAll()
 
-	file, err := parser.Parse(tks, func(s string) (*ast.File, error) {
+	file, parseErrs := parser.ParseAll(tks, func(s string) (*ast.File, error) {
 		if !filepath.IsAbs(s) {
 			s = filepath.Join(filepath.Dir(relPath), s)
 		}
 		return w.load(s, getContents, seen)
 	})
-	if err != nil {
-		return nil, fmt.Errorf("parse file: %w", err)
+
+	var errs ErrorList
+	errLines := make(map[int]struct{})
+
+	for _, e := range lexErrs {
+		errs = append(errs, fmt.Errorf("lex file: %w", e))
+		errLines[e.Location.Line] = struct{}{}
+	}
+	for _, e := range parseErrs {
+		// Lines with lexer errors are missing tokens, so any parser errors
+		// found on them are most likely caused by the former
+		if pe, ok := e.(*parser.ParserError); ok {
+			if _, ok := errLines[pe.Location.Line]; ok {
+				continue
+			}
+		}
+
+		errs = append(errs, fmt.Errorf("parse file: %w", e))
+	}
+
+	if len(errs) == 1 {
+		return file, errs[0]
+	}
+	if len(errs) > 0 {
+		return file, errs
+	}
+
+	if file.Extends != nil {
+		var err error
+
+		file, err = resolveExtends(file)
+		if err != nil {
+			return nil, fmt.Errorf("resolve extended file: %w", err)
+		}
 	}
 
 	w.parsedFiles[fullPath] = file
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"log"
@@ -12,6 +13,7 @@ import (
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/pipe01/poodle/internal/generator"
+	"github.com/pipe01/poodle/internal/typecheck"
 	"github.com/pipe01/poodle/internal/workspace"
 )
 
@@ -21,14 +23,24 @@ var (
 	packageName = kingpin.Flag("pkg", "Package name to set on generated files").Default("main").String()
 	forceExport = kingpin.Flag("export", "Make the first letter of all template names uppercase").Default("true").Bool()
 	bufioWriter = kingpin.Flag("bufio", "Use a *bufio.Writer as the writer for template functions, otherwise use io.Writer").Default("true").Bool()
-	watch       = kingpin.Flag("watch", "Watch files for changes and recompile automatically").Short('w').Bool()
-	files       = kingpin.Arg("files", "List of files to compile").Required().ExistingFiles()
+	returnError = kingpin.Flag("errors", "Make template functions return an error if writing the output fails").Bool()
+	useContext  = kingpin.Flag("context", "Add a context.Context parameter to template functions and stop rendering loops when it's cancelled, implies --errors").Bool()
+	pretty      = kingpin.Flag("pretty", "Indent the HTML output of templates according to the nesting of elements").Bool()
+	library     = kingpin.Flag("lib", "Compile the mixins in each file to exported functions instead of generating a template function").Bool()
+	lineDirs    = kingpin.Flag("line-directives", "Write //line directives so that Go compiler errors point to the template source").Default("true").Bool()
+
+	generateCmd = kingpin.Command("generate", "Generate Go code for templates").Default()
+	watch       = generateCmd.Flag("watch", "Watch files for changes and recompile automatically").Short('w').Bool()
+	files       = generateCmd.Arg("files", "List of files to compile").Required().ExistingFiles()
+
+	checkCmd   = kingpin.Command("check", "Type-check the code generated for templates as part of the package in the output folder, without writing any files")
+	checkFiles = checkCmd.Arg("files", "List of files to check").Required().ExistingFiles()
 
 	genOpts generator.Options
 )
 
 func main() {
-	kingpin.Parse()
+	cmd := kingpin.Parse()
 
 	*outDir, _ = filepath.Abs(*outDir)
 
@@ -36,33 +48,45 @@ func main() {
 		Package:        *packageName,
 		ForceExport:    *forceExport,
 		UseBufioWriter: *bufioWriter,
+		Library:        *library,
+		LineDirectives: *lineDirs,
+		ReturnError:    *returnError,
+		Context:        *useContext,
+		Pretty:         *pretty,
 	}
 
-	if *watch {
+	if cmd == checkCmd.FullCommand() {
+		if !checkAll() {
+			kingpin.Fatalf("found errors in templates")
+		}
+	} else if *watch {
 		err := watchFiles()
 		if err != nil {
 			kingpin.Fatalf("failed to watch files: %w", err)
 		}
 	} else {
-		err := generateAll()
-		if err != nil {
-			kingpin.Fatalf("failed to generate files: %s", err)
+		if !generateAll() {
+			kingpin.Fatalf("failed to generate files")
 		}
 	}
 }
 
-func generateAll() error {
+func generateAll() (ok bool) {
 	wd, _ := os.Getwd()
 	ws := workspace.New(wd)
 
+	ok = true
+
 	for _, fname := range *files {
 		_, err := generateFile(ws, fname, genOpts)
 		if err != nil {
-			return fmt.Errorf("load file %q: %s", fname, err)
+			log.Printf("failed to generate file %q:", fname)
+			printFileError(err)
+			ok = false
 		}
 	}
 
-	return nil
+	return ok
 }
 
 func generateFile(ws *workspace.Workspace, fname string, genOpts generator.Options) (outPath string, err error) {
@@ -74,6 +98,13 @@ func generateFile(ws *workspace.Workspace, fname string, genOpts generator.Optio
 	outName := fname + ".go"
 	outPath = filepath.Join(*outDir, outName)
 
+	if genOpts.LineDirectives {
+		genOpts.SourceDir, err = sourceDir(ws, outPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	outf, err := os.Create(outPath)
 	if err != nil {
 		return "", fmt.Errorf("create output file: %w", err)
@@ -97,6 +128,62 @@ func generateFile(ws *workspace.Workspace, fname string, genOpts generator.Optio
 	return outPath, nil
 }
 
+func checkAll() (ok bool) {
+	wd, _ := os.Getwd()
+	ws := workspace.New(wd)
+
+	ok = true
+
+	for _, fname := range *checkFiles {
+		err := checkFile(ws, fname, genOpts)
+		if err != nil {
+			log.Printf("errors in file %q:", fname)
+			printFileError(err)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func checkFile(ws *workspace.Workspace, fname string, genOpts generator.Options) error {
+	f, err := ws.Load(fname)
+	if err != nil {
+		return err
+	}
+
+	outPath := filepath.Join(*outDir, fname+".go")
+
+	// Line directives are needed to map errors back to the template
+	genOpts.LineDirectives = true
+	genOpts.SourceDir, err = sourceDir(ws, outPath)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	err = generator.Visit(&buf, f, genOpts)
+	if err != nil {
+		return fmt.Errorf("generate output: %w", err)
+	}
+
+	return typecheck.Check(outPath, buf.Bytes(), f, ws.RootPath())
+}
+
+// sourceDir returns the path of the workspace root relative to the directory
+// of the generated file at outPath.
+func sourceDir(ws *workspace.Workspace, outPath string) (string, error) {
+	rootPath, _ := filepath.Abs(ws.RootPath())
+
+	dir, err := filepath.Rel(filepath.Dir(outPath), rootPath)
+	if err != nil {
+		return "", fmt.Errorf("find template path relative to output: %w", err)
+	}
+
+	return dir, nil
+}
+
 func watchFiles() error {
 	watcher, err := NewWatcher()
 	if err != nil {
@@ -120,7 +207,15 @@ func watchFiles() error {
 }
 
 func printFileError(err error) {
-	var locErr SituatedErr
+	var errs workspace.ErrorList
+	if errors.As(err, &errs) {
+		for _, err := range errs {
+			printFileError(err)
+		}
+		return
+	}
+
+	locErr, _ := err.(SituatedErr)
 
 	for {
 		inner := errors.Unwrap(err)
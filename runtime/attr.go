@@ -0,0 +1,392 @@
+package runtime
+
+import (
+	"bufio"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Attributes that are enabled just by being present, regardless of their value
+var booleanAttributes = map[string]struct{}{
+	"allowfullscreen": {},
+	"async":           {},
+	"autofocus":       {},
+	"autoplay":        {},
+	"checked":         {},
+	"controls":        {},
+	"default":         {},
+	"defer":           {},
+	"disabled":        {},
+	"formnovalidate":  {},
+	"hidden":          {},
+	"inert":           {},
+	"ismap":           {},
+	"itemscope":       {},
+	"loop":            {},
+	"multiple":        {},
+	"muted":           {},
+	"nomodule":        {},
+	"novalidate":      {},
+	"open":            {},
+	"playsinline":     {},
+	"readonly":        {},
+	"required":        {},
+	"reversed":        {},
+	"selected":        {},
+}
+
+// Attributes whose value is a URL
+var urlAttributes = map[string]struct{}{
+	"action":     {},
+	"archive":    {},
+	"background": {},
+	"cite":       {},
+	"classid":    {},
+	"codebase":   {},
+	"data":       {},
+	"formaction": {},
+	"href":       {},
+	"icon":       {},
+	"longdesc":   {},
+	"manifest":   {},
+	"ping":       {},
+	"poster":     {},
+	"profile":    {},
+	"src":        {},
+	"usemap":     {},
+	"xmlns":      {},
+}
+
+// IsURLAttribute returns whether the value of the name attribute is a URL,
+// like the one of "href" or "src".
+func IsURLAttribute(name string) bool {
+	_, ok := urlAttributes[strings.ToLower(name)]
+	return ok
+}
+
+// IsBooleanAttribute returns whether name is an HTML boolean attribute, like
+// "disabled" or "checked".
+func IsBooleanAttribute(name string) bool {
+	_, ok := booleanAttributes[strings.ToLower(name)]
+	return ok
+}
+
+// OmitAttribute returns whether an attribute whose value is v shouldn't be
+// written at all, which is the case for false, nil and empty strings.
+func OmitAttribute(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	}
+
+	return false
+}
+
+// WriteAttribute writes a space followed by an attribute called name whose
+// value is v, escaped like WriteHTML does. If v is true or name is a boolean
+// attribute only the name is written, and nothing is written if OmitAttribute
+// returns true for v. The name isn't escaped.
+func WriteAttribute(w *bufio.Writer, name string, v any) (n int, err error) {
+	if OmitAttribute(v) {
+		return 0, nil
+	}
+
+	if _, ok := v.(bool); ok || IsBooleanAttribute(name) {
+		return writeStrings(w, " ", name)
+	}
+
+	n, err = writeStrings(w, " ", name, `="`)
+	if err != nil {
+		return n, err
+	}
+
+	nn, err := WriteHTML(w, v)
+	n += nn
+	if err != nil {
+		return n, err
+	}
+
+	nn, err = w.WriteString(`"`)
+	return n + nn, err
+}
+
+// Attribute is an HTML attribute whose name and value are only known at
+// runtime.
+type Attribute struct {
+	Name  string
+	Value any
+}
+
+// Attributes is an ordered list of attributes, like the ones added to an
+// element with "&attributes(...)". If more than one has the same name, the
+// last one is used.
+type Attributes []Attribute
+
+// Get returns the value of the last attribute called name, or nil if there
+// isn't any.
+func (a Attributes) Get(name string) any {
+	for i := len(a) - 1; i >= 0; i-- {
+		if a[i].Name == name {
+			return a[i].Value
+		}
+	}
+	return nil
+}
+
+// Has returns whether there is an attribute called name.
+func (a Attributes) Has(name string) bool {
+	return slices.ContainsFunc(a, func(attr Attribute) bool { return attr.Name == name })
+}
+
+// ToAttributes converts v to Attributes. v can be Attributes, nil, or a map
+// with string keys like map[string]any or map[string]bool from names to
+// values, in which case the attributes are sorted by name. Values of any other
+// type have no attributes.
+func ToAttributes(v any) Attributes {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case Attributes:
+		return v
+	case []Attribute:
+		return v
+	case map[string]any:
+		attrs := make(Attributes, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			attrs = append(attrs, Attribute{Name: k, Value: v[k]})
+		}
+		return attrs
+	case map[string]string:
+		attrs := make(Attributes, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			attrs = append(attrs, Attribute{Name: k, Value: v[k]})
+		}
+		return attrs
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil
+	}
+
+	attrs := make(Attributes, 0, rv.Len())
+	for iter := rv.MapRange(); iter.Next(); {
+		attrs = append(attrs, Attribute{Name: iter.Key().String(), Value: iter.Value().Interface()})
+	}
+	slices.SortFunc(attrs, func(a, b Attribute) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return attrs
+}
+
+// WriteAttributes writes each attribute in attrs like WriteAttribute does,
+// except for the ones called like any of the names in skip. Only the last
+// attribute with each name is written, and attributes whose name isn't valid
+// are left out. Values are escaped according to the attribute they're in,
+// class and style values are built with Classes and Styles.
+func WriteAttributes(w *bufio.Writer, attrs Attributes, skip ...string) (n int, err error) {
+	for i, attr := range attrs {
+		if !isValidAttributeName(attr.Name) || slices.Contains(skip, attr.Name) || attrs[i+1:].Has(attr.Name) {
+			continue
+		}
+
+		nn, err := WriteAttribute(w, attr.Name, attributeValue(attr.Name, attr.Value))
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// attributeValue returns v escaped for use as the value of the name
+// attribute. Values that make the attribute be left out or written without a
+// value are returned as they are.
+func attributeValue(name string, v any) any {
+	if _, ok := v.(bool); ok || OmitAttribute(v) {
+		return v
+	}
+
+	switch name = strings.ToLower(name); {
+	case IsURLAttribute(name):
+		return EscapeURL(v)
+	case name == "class":
+		return Classes(v)
+	case name == "style":
+		return Styles(v)
+	case strings.HasPrefix(name, "on"):
+		return EscapeJS(v)
+	}
+
+	return v
+}
+
+// isValidAttributeName returns whether name can be written as an attribute
+// name without changing the meaning of the rest of the element. Commas are
+// rejected too since they're most likely a mistake in a separated list.
+func isValidAttributeName(name string) bool {
+	return name != "" && !strings.ContainsFunc(name, func(r rune) bool {
+		return r <= ' ' || r == 0x7f || strings.ContainsRune(`"'>/=<,`, r)
+	})
+}
+
+func writeStrings(w *bufio.Writer, strs ...string) (n int, err error) {
+	for _, s := range strs {
+		nn, err := w.WriteString(s)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+// When returns v if cond is true, otherwise nil. It's used to conditionally
+// add a value to Classes or Styles.
+func When(cond bool, v any) any {
+	if cond {
+		return v
+	}
+	return nil
+}
+
+// Classes returns the space-separated list of class names in values, without
+// duplicates. Each value can be a string with one or more class names, a
+// []string, or a map[string]bool whose keys are included if their value is
+// true, in alphabetical order. Nil values are skipped.
+func Classes(values ...any) string {
+	var names []string
+
+	add := func(str string) {
+		for _, name := range strings.Fields(str) {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			add(v)
+		case []string:
+			for _, s := range v {
+				add(s)
+			}
+		case map[string]bool:
+			for _, k := range sortedKeys(v) {
+				if v[k] {
+					add(k)
+				}
+			}
+		default:
+			add(fmt.Sprint(v))
+		}
+	}
+
+	return strings.Join(names, " ")
+}
+
+// CSS is a string of trusted CSS declarations, which Styles doesn't escape.
+type CSS string
+
+// Styles returns the CSS declarations in values separated by semicolons, where
+// properties that are declared more than once take the last value. Each value
+// can be a string with declarations like "color: red; width: 10px", or a
+// map[string]string or map[string]any from property names to values, in
+// alphabetical order. Property values are filtered and escaped with
+// EscapeCSSValue, unless they're of type CSS. Nil values are skipped.
+func Styles(values ...any) string {
+	var props, vals []string
+
+	add := func(prop string, val string) {
+		prop = strings.TrimSpace(prop)
+		val = strings.TrimSpace(val)
+		if prop == "" || val == "" {
+			return
+		}
+
+		if i := slices.Index(props, prop); i >= 0 {
+			vals[i] = val
+		} else {
+			props = append(props, prop)
+			vals = append(vals, val)
+		}
+	}
+	addDecls := func(decls string, escape bool) {
+		for _, decl := range strings.Split(decls, ";") {
+			prop, val, _ := strings.Cut(decl, ":")
+			if escape {
+				val = EscapeCSSValue(strings.TrimSpace(val))
+			}
+			add(EscapeCSS(strings.TrimSpace(prop)), val)
+		}
+	}
+
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+		case CSS:
+			addDecls(string(v), false)
+		case string:
+			addDecls(v, true)
+		case map[string]string:
+			for _, k := range sortedKeys(v) {
+				add(EscapeCSS(k), EscapeCSSValue(v[k]))
+			}
+		case map[string]any:
+			for _, k := range sortedKeys(v) {
+				if val, ok := v[k].(CSS); ok {
+					add(EscapeCSS(k), string(val))
+				} else if v[k] != nil {
+					add(EscapeCSS(k), EscapeCSSValue(v[k]))
+				}
+			}
+		default:
+			addDecls(fmt.Sprint(v), true)
+		}
+	}
+
+	var b strings.Builder
+	for i, prop := range props {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(prop)
+		b.WriteString(": ")
+		b.WriteString(vals[i])
+	}
+
+	return b.String()
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+// Concat returns the text representations of values joined together, without
+// any separators.
+func Concat(values ...any) string {
+	var b strings.Builder
+	for _, v := range values {
+		fmt.Fprint(&b, v)
+	}
+
+	return b.String()
+}
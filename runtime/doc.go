@@ -0,0 +1,9 @@
+// Package runtime contains the helpers called by code generated by poodle.
+//
+// Generated files check that they're compatible with this package when
+// they're compiled, by declaring constants that overflow if the version of
+// the generated code is outside of [MinVersion, MaxVersion]. Functions that
+// generated code calls are kept for as long as the version that introduced
+// them is supported, so that files generated by older versions of poodle keep
+// compiling after this package is updated.
+package runtime
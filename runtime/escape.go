@@ -0,0 +1,204 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// InvalidURL is written in place of URLs with a scheme that isn't known to be safe.
+const InvalidURL = "about:invalid#poodle"
+
+// EscapeHTML escapes v for use in HTML text or inside a quoted attribute value.
+func EscapeHTML(v any) string {
+	return html.EscapeString(fmt.Sprint(v))
+}
+
+// EscapeURL filters out URLs with unsafe schemes like "javascript:", and
+// percent-encodes any characters that aren't allowed in a URL.
+func EscapeURL(v any) string {
+	s := fmt.Sprint(v)
+	if !isSafeURL(s) {
+		return InvalidURL
+	}
+
+	return processURL(s, true)
+}
+
+// NormalizeURL percent-encodes any characters that aren't allowed in a URL,
+// leaving existing escapes and reserved characters untouched.
+func NormalizeURL(v any) string {
+	return processURL(fmt.Sprint(v), true)
+}
+
+// EscapeURLComponent percent-encodes v so it can be used as a single query
+// parameter or fragment.
+func EscapeURLComponent(v any) string {
+	return processURL(fmt.Sprint(v), false)
+}
+
+// EscapeJS encodes v as a JavaScript literal that is safe to embed inside a
+// <script> element.
+func EscapeJS(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+
+	// json.Marshal escapes <, >, & and the JavaScript line terminators, so
+	// the result can't close the <script> element
+	return string(b)
+}
+
+// EscapeCSS escapes every character in v that could end a CSS value or
+// declaration, so it can be used inside a <style> element or a style attribute.
+func EscapeCSS(v any) string {
+	s := fmt.Sprint(v)
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for _, r := range s {
+		if isSafeCSSRune(r) {
+			b.WriteRune(r)
+		} else {
+			fmt.Fprintf(&b, `\%x `, r)
+		}
+	}
+
+	return b.String()
+}
+
+// InvalidCSS is written in place of CSS values that could run code or load
+// a URL with an unsafe scheme.
+const InvalidCSS = "ZpoodleZ"
+
+// EscapeCSSValue filters out CSS property values like "expression(...)" or
+// "url(javascript:...)", and escapes the characters that could end the value
+// or the declaration. Unlike EscapeCSS, functions like rgb(), calc() or var()
+// are kept as they are.
+func EscapeCSSValue(v any) string {
+	s := fmt.Sprint(v)
+	if !isSafeCSSValue(s) {
+		return InvalidCSS
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for _, r := range s {
+		if strings.ContainsRune(`;{}<>"'\`, r) {
+			fmt.Fprintf(&b, `\%x `, r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func isSafeCSSValue(s string) bool {
+	// Comments and whitespace are ignored between tokens, so they could be
+	// used to split the function names that are looked for
+	var b strings.Builder
+	for len(s) > 0 {
+		if strings.HasPrefix(s, "/*") {
+			_, s, _ = strings.Cut(s[2:], "*/")
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s)
+		if !unicode.IsSpace(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+		s = s[size:]
+	}
+	s = b.String()
+
+	if strings.Contains(s, "expression(") {
+		return false
+	}
+
+	for {
+		_, after, found := strings.Cut(s, "url(")
+		if !found {
+			return true
+		}
+
+		url, _, _ := strings.Cut(after, ")")
+		if !isSafeURL(strings.Trim(url, `"'`)) {
+			return false
+		}
+		s = after
+	}
+}
+
+func isSafeCSSRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r == '-', r == '_', r == '.', r == '#', r == '%', r == ',', r == ' ':
+		return true
+	}
+
+	return r >= utf8.RuneSelf
+}
+
+func isSafeURL(s string) bool {
+	scheme, _, found := strings.Cut(s, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		// Relative URL
+		return true
+	}
+
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+
+	return false
+}
+
+// processURL percent-encodes the bytes in s that aren't allowed in a URL. If
+// norm is true, reserved characters and existing escapes are kept as is.
+func processURL(s string, norm bool) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch c {
+		// Reserved characters
+		case '!', '#', '$', '&', '*', '+', ',', '/', ':', ';', '=', '?', '@', '[', ']':
+			if norm {
+				b.WriteByte(c)
+				continue
+			}
+
+		// Unreserved characters
+		case '-', '.', '_', '~':
+			b.WriteByte(c)
+			continue
+
+		case '%':
+			if norm {
+				b.WriteByte(c)
+				continue
+			}
+
+		default:
+			if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+				b.WriteByte(c)
+				continue
+			}
+		}
+
+		fmt.Fprintf(&b, "%%%02x", c)
+	}
+
+	return b.String()
+}
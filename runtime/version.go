@@ -0,0 +1,15 @@
+package runtime
+
+const (
+	// MaxVersion is the version of the code generated by the current version
+	// of poodle.
+	MaxVersion = 1
+
+	// MinVersion is the oldest version of generated code that is supported.
+	MinVersion = 1
+)
+
+// EnforceVersion is used by generated code to fail to compile if it's not
+// supported by this package. Converting a negative constant to it is an
+// error.
+type EnforceVersion uint
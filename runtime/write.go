@@ -0,0 +1,165 @@
+package runtime
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+var writerPool = sync.Pool{
+	New: func() any {
+		return bufio.NewWriter(nil)
+	},
+}
+
+// AcquireWriter returns a buffered writer that writes into w, reusing the
+// buffer of a writer that was previously released. The writer must be flushed
+// before being released with ReleaseWriter.
+func AcquireWriter(w io.Writer) *bufio.Writer {
+	bw := writerPool.Get().(*bufio.Writer)
+	bw.Reset(w)
+
+	return bw
+}
+
+// ReleaseWriter makes w available to be returned by AcquireWriter, it must not
+// be used afterwards. Any data that hasn't been flushed is discarded.
+func ReleaseWriter(w *bufio.Writer) {
+	w.Reset(nil)
+	writerPool.Put(w)
+}
+
+// Write writes the text representation of v to w without escaping it. Strings,
+// integers, booleans, errors and fmt.Stringer values are written straight into
+// w's buffer, anything else is formatted with fmt.Fprint.
+//
+// v escapes to the heap, so passing a value that doesn't fit in an interface
+// without boxing, like a string or a large integer, still allocates once.
+func Write(w *bufio.Writer, v any) (int, error) {
+	switch v := v.(type) {
+	case string:
+		return w.WriteString(v)
+	case bool:
+		return WriteBool(w, v)
+	case int:
+		return WriteInt(w, int64(v))
+	case int8:
+		return WriteInt(w, int64(v))
+	case int16:
+		return WriteInt(w, int64(v))
+	case int32:
+		return WriteInt(w, int64(v))
+	case int64:
+		return WriteInt(w, v)
+	case uint:
+		return WriteUint(w, uint64(v))
+	case uint8:
+		return WriteUint(w, uint64(v))
+	case uint16:
+		return WriteUint(w, uint64(v))
+	case uint32:
+		return WriteUint(w, uint64(v))
+	case uint64:
+		return WriteUint(w, v)
+	case error:
+		if !isNilPointer(v) {
+			return w.WriteString(v.Error())
+		}
+	case fmt.Stringer:
+		if !isNilPointer(v) {
+			return w.WriteString(v.String())
+		}
+	}
+
+	return fmt.Fprint(w, v)
+}
+
+// WriteHTML writes the text representation of v to w, escaped for use in HTML
+// text or inside a quoted attribute value. The same types as in Write are
+// written without formatting them into an intermediate string first, but v
+// escapes to the heap like it does there.
+func WriteHTML(w *bufio.Writer, v any) (int, error) {
+	switch v := v.(type) {
+	case string:
+		return WriteHTMLString(w, v)
+	case error:
+		if !isNilPointer(v) {
+			return WriteHTMLString(w, v.Error())
+		}
+	case fmt.Stringer:
+		if !isNilPointer(v) {
+			return WriteHTMLString(w, v.String())
+		}
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		// Numbers and booleans never need to be escaped
+		return Write(w, v)
+	}
+
+	return WriteHTMLString(w, fmt.Sprint(v))
+}
+
+// isNilPointer returns whether v is a nil pointer, whose methods are left to
+// fmt since it prints "<nil>" if they panic.
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// WriteHTMLString writes s to w, escaping it like EscapeHTML does.
+func WriteHTMLString(w *bufio.Writer, s string) (n int, err error) {
+	last := 0
+
+	for i := 0; i < len(s); i++ {
+		var esc string
+
+		switch s[i] {
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '&':
+			esc = "&amp;"
+		case '\'':
+			esc = "&#39;"
+		case '"':
+			esc = "&#34;"
+		default:
+			continue
+		}
+
+		nn, err := w.WriteString(s[last:i])
+		n += nn
+		if err != nil {
+			return n, err
+		}
+
+		nn, err = w.WriteString(esc)
+		n += nn
+		if err != nil {
+			return n, err
+		}
+
+		last = i + 1
+	}
+
+	nn, err := w.WriteString(s[last:])
+	return n + nn, err
+}
+
+// WriteInt writes the decimal representation of v to w.
+func WriteInt(w *bufio.Writer, v int64) (int, error) {
+	return w.Write(strconv.AppendInt(w.AvailableBuffer(), v, 10))
+}
+
+// WriteUint writes the decimal representation of v to w.
+func WriteUint(w *bufio.Writer, v uint64) (int, error) {
+	return w.Write(strconv.AppendUint(w.AvailableBuffer(), v, 10))
+}
+
+// WriteBool writes "true" or "false" to w.
+func WriteBool(w *bufio.Writer, v bool) (int, error) {
+	return w.WriteString(strconv.FormatBool(v))
+}
@@ -0,0 +1,144 @@
+package runtime
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pointerStringer struct{}
+
+func (*pointerStringer) String() string { return "<ptr>" }
+
+// valueError has a value receiver, so calling Error on a nil pointer panics
+type valueError struct{ msg string }
+
+func (e valueError) Error() string { return e.msg }
+
+var writeTests = []struct {
+	name     string
+	v        any
+	want     string
+	wantHTML string
+}{
+	{"String", `<a href="x">'&'</a>`, `<a href="x">'&'</a>`, "&lt;a href=&#34;x&#34;&gt;&#39;&amp;&#39;&lt;/a&gt;"},
+	{"EmptyString", "", "", ""},
+	{"Int", -42, "-42", "-42"},
+	{"Int8", int8(-8), "-8", "-8"},
+	{"Int64", int64(1) << 40, "1099511627776", "1099511627776"},
+	{"Uint", uint(7), "7", "7"},
+	{"Uint8", uint8(255), "255", "255"},
+	{"Uint64", uint64(1) << 63, "9223372036854775808", "9223372036854775808"},
+	{"Bool", true, "true", "true"},
+	{"Error", errors.New("a < b"), "a < b", "a &lt; b"},
+	{"Stringer", 90 * time.Second, "1m30s", "1m30s"},
+	{"PointerStringer", &pointerStringer{}, "<ptr>", "&lt;ptr&gt;"},
+	{"NilPointerStringer", (*time.Time)(nil), "<nil>", "&lt;nil&gt;"},
+	{"NilPointerError", (*valueError)(nil), "<nil>", "&lt;nil&gt;"},
+	{"NilPointerWithNilSafeMethod", (*pointerStringer)(nil), "<ptr>", "&lt;ptr&gt;"},
+	{"Nil", nil, "<nil>", "&lt;nil&gt;"},
+	{"Other", []string{"<a>", "b"}, "[<a> b]", "[&lt;a&gt; b]"},
+}
+
+func TestWrite(t *testing.T) {
+	for _, tt := range writeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := writeString(t, Write, tt.v); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	for _, tt := range writeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := writeString(t, WriteHTML, tt.v); got != tt.wantHTML {
+				t.Errorf("got %q, want %q", got, tt.wantHTML)
+			}
+			if want := html.EscapeString(fmt.Sprint(tt.v)); tt.wantHTML != want {
+				t.Errorf("escaped output %q differs from html.EscapeString(fmt.Sprint(v)) %q", tt.wantHTML, want)
+			}
+		})
+	}
+}
+
+// writeString returns what write writes for v, checking that the number of
+// bytes it returns is right.
+func writeString(t *testing.T, write func(*bufio.Writer, any) (int, error), v any) string {
+	t.Helper()
+
+	var b strings.Builder
+	w := bufio.NewWriter(&b)
+
+	n, err := write(w, v)
+	if err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	w.Flush()
+
+	if n != b.Len() {
+		t.Errorf("returned %d bytes written, but wrote %d", n, b.Len())
+	}
+
+	return b.String()
+}
+
+// Values are passed as their concrete types, like generated code does, so
+// that converting them to interfaces is included in the benchmarks.
+var (
+	benchString   = "<p>Hello, world & everyone</p>"
+	benchInt      = 123456
+	benchStringer = 3 * time.Second
+)
+
+func BenchmarkWriteHTML(b *testing.B) {
+	w := bufio.NewWriter(io.Discard)
+
+	b.Run("String", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			WriteHTML(w, benchString)
+		}
+	})
+	b.Run("Int", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			WriteHTML(w, benchInt)
+		}
+	})
+	b.Run("Stringer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			WriteHTML(w, benchStringer)
+		}
+	})
+}
+
+func BenchmarkEscapeSprint(b *testing.B) {
+	w := bufio.NewWriter(io.Discard)
+
+	b.Run("String", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w.WriteString(html.EscapeString(fmt.Sprint(benchString)))
+		}
+	})
+	b.Run("Int", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w.WriteString(html.EscapeString(fmt.Sprint(benchInt)))
+		}
+	})
+	b.Run("Stringer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			w.WriteString(html.EscapeString(fmt.Sprint(benchStringer)))
+		}
+	})
+}
@@ -21,7 +21,10 @@ export function activate(context: vscode.ExtensionContext) {
 
 	const clientOptions: LanguageClientOptions = {
 		documentSelector: [{ scheme: 'file', language: 'poodle' }],
-		outputChannelName: "test"
+		outputChannelName: "test",
+		initializationOptions: {
+			typeCheck: vscode.workspace.getConfiguration('poodle').get<boolean>('typeCheck', false)
+		}
 	};
 
 	client = new LanguageClient(